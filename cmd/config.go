@@ -4,28 +4,97 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
+	"github.com/bonus2k/xray-tlg/internal/backup"
+	"github.com/bonus2k/xray-tlg/internal/handlers"
+	"github.com/bonus2k/xray-tlg/internal/subscription"
+	"github.com/bonus2k/xray-tlg/internal/totp"
 	flags "github.com/jessevdk/go-flags"
 )
 
 const (
 	runModeConsole = "console"
 	runModeService = "service"
+
+	minCallbackSecretLength = 16
+
+	// validatorDisabled turns the external config validator off.
+	validatorDisabled       = "none"
+	defaultValidatorCommand = "xray run -test -config " + handlers.ValidatorConfigPlaceholder
+
+	credentialsDirEnv   = "CREDENTIALS_DIRECTORY"
+	tokenCredentialName = "token"
+
+	// defaultUploadMaxSize is far above any real client config; the Bot API
+	// does not let bots download files larger than maxUploadMaxSize.
+	defaultUploadMaxSize = 1 << 20
+	maxUploadMaxSize     = 20 << 20
+
+	// maxConfigPageSize keeps a page with 🔍 and 📤 next to every config
+	// under the Bot API limit of 100 buttons per keyboard.
+	maxConfigPageSize = 25
+
+	defaultSubscriptionInterval = "6h"
+	minSubscriptionInterval     = time.Minute
+	maxSubscriptionNameLength   = 64
 )
 
+// subscriptionNamePattern keeps subscription names usable as directory names
+// and out of hidden directories like the trash.
+var subscriptionNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// SubscriptionConfig is a subscription URL whose servers are kept as configs
+// in the subdirectory Name of xray_configs_dir.
+type SubscriptionConfig struct {
+	Name            string `json:"name"`
+	URL             string `json:"url"`
+	RefreshInterval string `json:"refresh_interval"`
+}
+
 type Config struct {
-	RunMode        string `json:"run_mode" long:"run-mode" choice:"console" choice:"service" env:"RUN_MODE" description:"Run mode: console or service"`
-	ConfigPath     string `json:"config" long:"config" short:"c" env:"CONFIG" default:"" description:"Path to bot JSON config"`
-	Token          string `json:"token" long:"token" short:"t" env:"TOKEN" default:"" description:"Telegram bot token"`
-	XrayConfigsDir string `json:"xray_configs_dir" long:"xray-configs-dir" short:"d" env:"XRAY_CONFIGS_DIR" default:"" description:"Directory with Xray client configs"`
-	XrayConfigPath string `json:"xray_config_path" long:"xray-config-path" short:"p" env:"XRAY_CONFIG_PATH" default:"" description:"Active Xray config path"`
-	ServiceName    string `json:"service_name" long:"service-name" env:"SERVICE_NAME" default:"" description:"Systemd service name to restart"`
-	LockTimeout    string `json:"lock_timeout" long:"lock-timeout" env:"LOCK_TIMEOUT" description:"Command lock timeout (e.g. 90s)"`
-	LogLevel       string `json:"log_level" long:"log-level" env:"LOG_LEVEL" description:"Logger level: debug, info, warn, error"`
+	RunMode          string           `json:"run_mode" long:"run-mode" choice:"console" choice:"service" env:"RUN_MODE" description:"Run mode: console or service"`
+	ConfigPath       string           `json:"config" long:"config" short:"c" env:"CONFIG" default:"" description:"Path to bot JSON config"`
+	Token            string           `json:"token" long:"token" short:"t" env:"TOKEN" default:"" description:"Telegram bot token"`
+	TokenFile        string           `json:"token_file" long:"token-file" env:"TOKEN_FILE" description:"File with the Telegram bot token"`
+	XrayConfigsDir   string           `json:"xray_configs_dir" long:"xray-configs-dir" short:"d" env:"XRAY_CONFIGS_DIR" default:"" description:"Directory with Xray client configs"`
+	XrayConfigPath   string           `json:"xray_config_path" long:"xray-config-path" short:"p" env:"XRAY_CONFIG_PATH" default:"" description:"Active Xray config path"`
+	ServiceName      string           `json:"service_name" long:"service-name" env:"SERVICE_NAME" default:"" description:"Systemd service name to restart"`
+	LockTimeout      string           `json:"lock_timeout" long:"lock-timeout" env:"LOCK_TIMEOUT" description:"Command lock timeout (e.g. 90s)"`
+	LogLevel         string           `json:"log_level" long:"log-level" env:"LOG_LEVEL" description:"Logger level: debug, info, warn, error"`
+	AllowedUserIDs   []int64          `json:"allowed_user_ids" long:"allowed-user-id" env:"ALLOWED_USER_IDS" env-delim:"," description:"Telegram user ID allowed to use the bot (repeatable)"`
+	AllowedChatIDs   []int64          `json:"allowed_chat_ids" long:"allowed-chat-id" env:"ALLOWED_CHAT_IDS" env-delim:"," description:"Telegram chat ID allowed to use the bot (repeatable)"`
+	Roles            map[int64]string `json:"roles" long:"role" env:"ROLES" env-delim:"," description:"User role as <user_id>:<viewer|operator|admin> (repeatable)"`
+	DefaultRole      string           `json:"default_role" long:"default-role" env:"DEFAULT_ROLE" description:"Role for users without an explicit role"`
+	CallbackSecret   string           `json:"callback_secret" long:"callback-secret" env:"CALLBACK_SECRET" description:"Secret used to sign inline button data"`
+	CallbackTTL      string           `json:"callback_ttl" long:"callback-ttl" env:"CALLBACK_TTL" description:"How long inline buttons stay valid (e.g. 24h)"`
+	ConfirmTimeout   string           `json:"confirm_timeout" long:"confirm-timeout" env:"CONFIRM_TIMEOUT" description:"How long a confirmation screen stays valid (e.g. 60s)"`
+	SkipConfirm      []string         `json:"skip_confirm" long:"skip-confirm" env:"SKIP_CONFIRM" env-delim:"," description:"Action that runs without confirmation: restart, apply, rollback or delete (repeatable)"`
+	TOTPSecrets      map[int64]string `json:"totp_secrets" long:"totp-secret" env:"TOTP_SECRETS" env-delim:"," description:"Base32 TOTP secret as <user_id>:<secret> (repeatable)"`
+	AuditLogPath     string           `json:"audit_log_path" long:"audit-log-path" env:"AUDIT_LOG_PATH" description:"Append-only JSONL audit log path"`
+	RateLimit        int              `json:"rate_limit" long:"rate-limit" env:"RATE_LIMIT" description:"Updates per minute allowed for each user (negative disables the limit)"`
+	RateBurst        int              `json:"rate_burst" long:"rate-burst" env:"RATE_BURST" description:"Updates a user may send in a quick burst"`
+	RateBanAfter     int              `json:"rate_ban_after" long:"rate-ban-after" env:"RATE_BAN_AFTER" description:"Rate limit violations within a minute before a temporary ban (negative disables bans)"`
+	RateBanTime      string           `json:"rate_ban_time" long:"rate-ban-time" env:"RATE_BAN_TIME" description:"Temporary ban duration (e.g. 10m)"`
+	ValidatorCommand string           `json:"validator_command" long:"validator-command" env:"VALIDATOR_COMMAND" description:"Command that checks a config before apply, {config} is the file path (none disables)"`
+	ValidatorTimeout string           `json:"validator_timeout" long:"validator-timeout" env:"VALIDATOR_TIMEOUT" description:"Validator command timeout (e.g. 30s)"`
+	BackupDir        string           `json:"backup_dir" long:"backup-dir" env:"BACKUP_DIR" description:"Directory with backups of the active config"`
+	BackupCount      int              `json:"backup_count" long:"backup-count" env:"BACKUP_COUNT" description:"Number of active config backups to keep (negative disables backups)"`
+	RestartGrace     string           `json:"restart_grace" long:"restart-grace" env:"RESTART_GRACE" description:"How long the service must stay up after a restart (e.g. 10s, 0 disables the check)"`
+	RestartProbe     string           `json:"restart_probe" long:"restart-probe" env:"RESTART_PROBE" description:"host:port that must accept TCP connections after a restart"`
+	StatePath        string           `json:"state_path" long:"state-path" env:"STATE_PATH" description:"File where the bot remembers the last applied config"`
+	UploadMaxSize    int              `json:"upload_max_size" long:"upload-max-size" env:"UPLOAD_MAX_SIZE" description:"Maximum size of an uploaded config in bytes (negative disables uploads)"`
+	BaseTemplate     string           `json:"base_template" long:"base-template" env:"BASE_TEMPLATE" description:"Base Xray config that profiles without inbounds are merged into"`
+	NotifyChatIDs    []int64          `json:"notify_chat_ids" long:"notify-chat-id" env:"NOTIFY_CHAT_IDS" env-delim:"," description:"Telegram chat ID that receives subscription refresh reports (repeatable)"`
+	ConfigPageSize   int              `json:"config_page_size" long:"config-page-size" env:"CONFIG_PAGE_SIZE" description:"Number of folders and configs per page of the config list"`
+	// Subscriptions can only be set in the JSON config.
+	Subscriptions []SubscriptionConfig `json:"subscriptions"`
 }
 
 type bootstrapArgs struct {
@@ -34,14 +103,40 @@ type bootstrapArgs struct {
 }
 
 type configOverrides struct {
-	RunMode        *string `long:"run-mode" choice:"console" choice:"service" env:"RUN_MODE"`
-	ConfigPath     *string `long:"config" short:"c" env:"CONFIG"`
-	Token          *string `long:"token" short:"t" env:"TOKEN"`
-	XrayConfigsDir *string `long:"xray-configs-dir" short:"d" env:"XRAY_CONFIGS_DIR"`
-	XrayConfigPath *string `long:"xray-config-path" short:"p" env:"XRAY_CONFIG_PATH"`
-	ServiceName    *string `long:"service-name" env:"SERVICE_NAME"`
-	LockTimeout    *string `long:"lock-timeout" env:"LOCK_TIMEOUT"`
-	LogLevel       *string `long:"log-level" env:"LOG_LEVEL"`
+	RunMode          *string          `long:"run-mode" choice:"console" choice:"service" env:"RUN_MODE"`
+	ConfigPath       *string          `long:"config" short:"c" env:"CONFIG"`
+	Token            *string          `long:"token" short:"t" env:"TOKEN"`
+	TokenFile        *string          `long:"token-file" env:"TOKEN_FILE"`
+	XrayConfigsDir   *string          `long:"xray-configs-dir" short:"d" env:"XRAY_CONFIGS_DIR"`
+	XrayConfigPath   *string          `long:"xray-config-path" short:"p" env:"XRAY_CONFIG_PATH"`
+	ServiceName      *string          `long:"service-name" env:"SERVICE_NAME"`
+	LockTimeout      *string          `long:"lock-timeout" env:"LOCK_TIMEOUT"`
+	LogLevel         *string          `long:"log-level" env:"LOG_LEVEL"`
+	AllowedUserIDs   []int64          `long:"allowed-user-id" env:"ALLOWED_USER_IDS" env-delim:","`
+	AllowedChatIDs   []int64          `long:"allowed-chat-id" env:"ALLOWED_CHAT_IDS" env-delim:","`
+	Roles            map[int64]string `long:"role" env:"ROLES" env-delim:","`
+	DefaultRole      *string          `long:"default-role" env:"DEFAULT_ROLE"`
+	CallbackSecret   *string          `long:"callback-secret" env:"CALLBACK_SECRET"`
+	CallbackTTL      *string          `long:"callback-ttl" env:"CALLBACK_TTL"`
+	ConfirmTimeout   *string          `long:"confirm-timeout" env:"CONFIRM_TIMEOUT"`
+	SkipConfirm      []string         `long:"skip-confirm" env:"SKIP_CONFIRM" env-delim:","`
+	TOTPSecrets      map[int64]string `long:"totp-secret" env:"TOTP_SECRETS" env-delim:","`
+	AuditLogPath     *string          `long:"audit-log-path" env:"AUDIT_LOG_PATH"`
+	RateLimit        *int             `long:"rate-limit" env:"RATE_LIMIT"`
+	RateBurst        *int             `long:"rate-burst" env:"RATE_BURST"`
+	RateBanAfter     *int             `long:"rate-ban-after" env:"RATE_BAN_AFTER"`
+	RateBanTime      *string          `long:"rate-ban-time" env:"RATE_BAN_TIME"`
+	ValidatorCommand *string          `long:"validator-command" env:"VALIDATOR_COMMAND"`
+	ValidatorTimeout *string          `long:"validator-timeout" env:"VALIDATOR_TIMEOUT"`
+	BackupDir        *string          `long:"backup-dir" env:"BACKUP_DIR"`
+	BackupCount      *int             `long:"backup-count" env:"BACKUP_COUNT"`
+	RestartGrace     *string          `long:"restart-grace" env:"RESTART_GRACE"`
+	RestartProbe     *string          `long:"restart-probe" env:"RESTART_PROBE"`
+	StatePath        *string          `long:"state-path" env:"STATE_PATH"`
+	UploadMaxSize    *int             `long:"upload-max-size" env:"UPLOAD_MAX_SIZE"`
+	BaseTemplate     *string          `long:"base-template" env:"BASE_TEMPLATE"`
+	NotifyChatIDs    []int64          `long:"notify-chat-id" env:"NOTIFY_CHAT_IDS" env-delim:","`
+	ConfigPageSize   *int             `long:"config-page-size" env:"CONFIG_PAGE_SIZE"`
 }
 
 func LoadConfig(args []string) (Config, error) {
@@ -76,6 +171,10 @@ func LoadConfig(args []string) (Config, error) {
 		cfg.RunMode = modeHint
 	}
 
+	if err := resolveToken(&cfg); err != nil {
+		return Config{}, err
+	}
+
 	applyCommonDefaults(&cfg)
 	cfg, err = finalizeConfigByRunMode(cfg)
 	if err != nil {
@@ -144,6 +243,9 @@ func applyOverrides(cfg *Config, overrides configOverrides) {
 	if overrides.Token != nil {
 		cfg.Token = *overrides.Token
 	}
+	if overrides.TokenFile != nil {
+		cfg.TokenFile = *overrides.TokenFile
+	}
 	if overrides.XrayConfigsDir != nil {
 		cfg.XrayConfigsDir = *overrides.XrayConfigsDir
 	}
@@ -159,6 +261,120 @@ func applyOverrides(cfg *Config, overrides configOverrides) {
 	if overrides.LogLevel != nil {
 		cfg.LogLevel = *overrides.LogLevel
 	}
+	if overrides.AllowedUserIDs != nil {
+		cfg.AllowedUserIDs = overrides.AllowedUserIDs
+	}
+	if overrides.AllowedChatIDs != nil {
+		cfg.AllowedChatIDs = overrides.AllowedChatIDs
+	}
+	if overrides.Roles != nil {
+		cfg.Roles = overrides.Roles
+	}
+	if overrides.DefaultRole != nil {
+		cfg.DefaultRole = *overrides.DefaultRole
+	}
+	if overrides.CallbackSecret != nil {
+		cfg.CallbackSecret = *overrides.CallbackSecret
+	}
+	if overrides.CallbackTTL != nil {
+		cfg.CallbackTTL = *overrides.CallbackTTL
+	}
+	if overrides.ConfirmTimeout != nil {
+		cfg.ConfirmTimeout = *overrides.ConfirmTimeout
+	}
+	if overrides.SkipConfirm != nil {
+		cfg.SkipConfirm = overrides.SkipConfirm
+	}
+	if overrides.TOTPSecrets != nil {
+		cfg.TOTPSecrets = overrides.TOTPSecrets
+	}
+	if overrides.AuditLogPath != nil {
+		cfg.AuditLogPath = *overrides.AuditLogPath
+	}
+	if overrides.RateLimit != nil {
+		cfg.RateLimit = *overrides.RateLimit
+	}
+	if overrides.RateBurst != nil {
+		cfg.RateBurst = *overrides.RateBurst
+	}
+	if overrides.RateBanAfter != nil {
+		cfg.RateBanAfter = *overrides.RateBanAfter
+	}
+	if overrides.RateBanTime != nil {
+		cfg.RateBanTime = *overrides.RateBanTime
+	}
+	if overrides.ValidatorCommand != nil {
+		cfg.ValidatorCommand = *overrides.ValidatorCommand
+	}
+	if overrides.ValidatorTimeout != nil {
+		cfg.ValidatorTimeout = *overrides.ValidatorTimeout
+	}
+	if overrides.BackupDir != nil {
+		cfg.BackupDir = *overrides.BackupDir
+	}
+	if overrides.BackupCount != nil {
+		cfg.BackupCount = *overrides.BackupCount
+	}
+	if overrides.RestartGrace != nil {
+		cfg.RestartGrace = *overrides.RestartGrace
+	}
+	if overrides.RestartProbe != nil {
+		cfg.RestartProbe = *overrides.RestartProbe
+	}
+	if overrides.StatePath != nil {
+		cfg.StatePath = *overrides.StatePath
+	}
+	if overrides.UploadMaxSize != nil {
+		cfg.UploadMaxSize = *overrides.UploadMaxSize
+	}
+	if overrides.BaseTemplate != nil {
+		cfg.BaseTemplate = *overrides.BaseTemplate
+	}
+	if overrides.NotifyChatIDs != nil {
+		cfg.NotifyChatIDs = overrides.NotifyChatIDs
+	}
+	if overrides.ConfigPageSize != nil {
+		cfg.ConfigPageSize = *overrides.ConfigPageSize
+	}
+}
+
+// resolveToken fills an empty token from token_file or, under systemd, from
+// the "token" credential passed with LoadCredential=.
+func resolveToken(cfg *Config) error {
+	if strings.TrimSpace(cfg.Token) != "" {
+		return nil
+	}
+
+	if strings.TrimSpace(cfg.TokenFile) != "" {
+		token, err := readTokenFile(cfg.TokenFile)
+		if err != nil {
+			return fmt.Errorf("read token file: %w", err)
+		}
+		cfg.Token = token
+		return nil
+	}
+
+	credentialsDir := strings.TrimSpace(os.Getenv(credentialsDirEnv))
+	if credentialsDir == "" {
+		return nil
+	}
+	token, err := readTokenFile(filepath.Join(credentialsDir, tokenCredentialName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("read token credential: %w", err)
+	}
+	cfg.Token = token
+	return nil
+}
+
+func readTokenFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
 }
 
 func applyCommonDefaults(cfg *Config) {
@@ -168,6 +384,54 @@ func applyCommonDefaults(cfg *Config) {
 	if strings.TrimSpace(cfg.LogLevel) == "" {
 		cfg.LogLevel = "info"
 	}
+	if strings.TrimSpace(cfg.CallbackTTL) == "" {
+		cfg.CallbackTTL = "24h"
+	}
+	if strings.TrimSpace(cfg.ConfirmTimeout) == "" {
+		cfg.ConfirmTimeout = "60s"
+	}
+	if cfg.RateLimit == 0 {
+		cfg.RateLimit = 30
+	}
+	if cfg.RateBurst == 0 {
+		cfg.RateBurst = 10
+	}
+	if cfg.RateBanAfter == 0 {
+		cfg.RateBanAfter = 5
+	}
+	if strings.TrimSpace(cfg.RateBanTime) == "" {
+		cfg.RateBanTime = "10m"
+	}
+	if strings.TrimSpace(cfg.ValidatorCommand) == "" {
+		cfg.ValidatorCommand = defaultValidatorCommand
+	}
+	if strings.TrimSpace(cfg.ValidatorTimeout) == "" {
+		cfg.ValidatorTimeout = "30s"
+	}
+	if cfg.BackupCount == 0 {
+		cfg.BackupCount = 10
+	}
+	if strings.TrimSpace(cfg.RestartGrace) == "" {
+		cfg.RestartGrace = "10s"
+	}
+	if cfg.UploadMaxSize == 0 {
+		cfg.UploadMaxSize = defaultUploadMaxSize
+	}
+	if cfg.ConfigPageSize == 0 {
+		cfg.ConfigPageSize = handlers.DefaultPageSize
+	}
+	for i := range cfg.Subscriptions {
+		if strings.TrimSpace(cfg.Subscriptions[i].RefreshInterval) == "" {
+			cfg.Subscriptions[i].RefreshInterval = defaultSubscriptionInterval
+		}
+	}
+	if strings.TrimSpace(cfg.DefaultRole) == "" {
+		// Without a role map everyone keeps full access, as before roles existed.
+		cfg.DefaultRole = "admin"
+		if len(cfg.Roles) > 0 {
+			cfg.DefaultRole = "viewer"
+		}
+	}
 }
 
 func finalizeConfigByRunMode(cfg Config) (Config, error) {
@@ -191,6 +455,15 @@ func finalizeConsoleConfig(cfg Config) Config {
 	if cfg.ServiceName == "" {
 		cfg.ServiceName = "xray"
 	}
+	if cfg.AuditLogPath == "" {
+		cfg.AuditLogPath = "./audit.jsonl"
+	}
+	if cfg.StatePath == "" {
+		cfg.StatePath = "./state.json"
+	}
+	if cfg.BackupDir == "" {
+		cfg.BackupDir = defaultBackupDir(cfg.XrayConfigPath)
+	}
 	return cfg
 }
 
@@ -204,9 +477,24 @@ func finalizeServiceConfig(cfg Config) Config {
 	if cfg.ServiceName == "" {
 		cfg.ServiceName = "xray"
 	}
+	if cfg.AuditLogPath == "" {
+		cfg.AuditLogPath = "/var/log/xray-tlg/audit.jsonl"
+	}
+	if cfg.StatePath == "" {
+		cfg.StatePath = "/var/lib/xray-tlg/state.json"
+	}
+	if cfg.BackupDir == "" {
+		cfg.BackupDir = defaultBackupDir(cfg.XrayConfigPath)
+	}
 	return cfg
 }
 
+// defaultBackupDir keeps backups next to the active config in a hidden
+// directory, so they are not mistaken for profiles.
+func defaultBackupDir(xrayConfigPath string) string {
+	return filepath.Join(filepath.Dir(xrayConfigPath), ".xray-tlg-backups")
+}
+
 func resolveConfigPath(runMode string, provided string) string {
 	if strings.TrimSpace(provided) != "" {
 		return provided
@@ -247,10 +535,126 @@ func validateConfig(cfg Config) error {
 	if strings.TrimSpace(cfg.ServiceName) == "" {
 		return errors.New("service name is required")
 	}
+	if strings.TrimSpace(cfg.AuditLogPath) == "" {
+		return errors.New("audit log path is required")
+	}
 	duration, err := time.ParseDuration(cfg.LockTimeout)
 	if err != nil || duration <= 0 {
 		return errors.New("lock timeout must be greater than zero")
 	}
+	callbackTTL, err := time.ParseDuration(cfg.CallbackTTL)
+	if err != nil || callbackTTL <= 0 {
+		return errors.New("callback ttl must be greater than zero")
+	}
+	if cfg.CallbackSecret != "" && len(cfg.CallbackSecret) < minCallbackSecretLength {
+		return fmt.Errorf("callback secret must be at least %d characters", minCallbackSecretLength)
+	}
+	confirmTimeout, err := time.ParseDuration(cfg.ConfirmTimeout)
+	if err != nil || confirmTimeout <= 0 {
+		return errors.New("confirm timeout must be greater than zero")
+	}
+	if cfg.RateBurst < 0 {
+		return errors.New("rate burst must be greater than zero")
+	}
+	rateBanTime, err := time.ParseDuration(cfg.RateBanTime)
+	if err != nil || rateBanTime <= 0 {
+		return errors.New("rate ban time must be greater than zero")
+	}
+	validatorTimeout, err := time.ParseDuration(cfg.ValidatorTimeout)
+	if err != nil || validatorTimeout <= 0 {
+		return errors.New("validator timeout must be greater than zero")
+	}
+	restartGrace, err := time.ParseDuration(cfg.RestartGrace)
+	if err != nil || restartGrace < 0 {
+		return errors.New("restart grace must not be negative")
+	}
+	if cfg.RestartProbe != "" {
+		if _, _, err := net.SplitHostPort(cfg.RestartProbe); err != nil {
+			return fmt.Errorf("restart probe: %w", err)
+		}
+	}
+	if cfg.UploadMaxSize > maxUploadMaxSize {
+		return fmt.Errorf("upload max size must not exceed %d bytes", maxUploadMaxSize)
+	}
+	if cfg.ConfigPageSize < 1 || cfg.ConfigPageSize > maxConfigPageSize {
+		return fmt.Errorf("config page size must be between 1 and %d", maxConfigPageSize)
+	}
+	if err := validateBaseTemplate(cfg); err != nil {
+		return err
+	}
+	if err := validateSubscriptions(cfg.Subscriptions); err != nil {
+		return err
+	}
+	for _, action := range cfg.SkipConfirm {
+		if !handlers.IsConfirmAction(action) {
+			return fmt.Errorf("unsupported skip_confirm action: %s", action)
+		}
+	}
+	for userID, secret := range cfg.TOTPSecrets {
+		if _, err := totp.DecodeSecret(secret); err != nil {
+			return fmt.Errorf("totp secret for user %d: %w", userID, err)
+		}
+	}
+	if _, err := handlers.ParseRole(cfg.DefaultRole); err != nil {
+		return fmt.Errorf("default role: %w", err)
+	}
+	for userID, role := range cfg.Roles {
+		if _, err := handlers.ParseRole(role); err != nil {
+			return fmt.Errorf("role for user %d: %w", userID, err)
+		}
+	}
+	return nil
+}
+
+// validateBaseTemplate only checks that the template is a file outside the
+// profile directory, where it would be listed as a profile itself. Its content
+// is read on every apply.
+func validateBaseTemplate(cfg Config) error {
+	if cfg.BaseTemplate == "" {
+		return nil
+	}
+	info, err := os.Stat(cfg.BaseTemplate)
+	if err != nil {
+		return fmt.Errorf("base template: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("base template %s is not a regular file", cfg.BaseTemplate)
+	}
+	templateDir, err := filepath.Abs(filepath.Dir(cfg.BaseTemplate))
+	if err != nil {
+		return fmt.Errorf("base template: %w", err)
+	}
+	configsDir, err := filepath.Abs(cfg.XrayConfigsDir)
+	if err != nil {
+		return fmt.Errorf("xray configs dir: %w", err)
+	}
+	if rel, err := filepath.Rel(configsDir, templateDir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errors.New("base template must be outside xray configs dir")
+	}
+	return nil
+}
+
+func validateSubscriptions(subscriptions []SubscriptionConfig) error {
+	names := make(map[string]struct{}, len(subscriptions))
+	for _, sub := range subscriptions {
+		if !subscriptionNamePattern.MatchString(sub.Name) || len(sub.Name) > maxSubscriptionNameLength {
+			return fmt.Errorf("subscription name %q must be up to %d letters, digits, dots, dashes or underscores", sub.Name, maxSubscriptionNameLength)
+		}
+		if _, ok := names[sub.Name]; ok {
+			return fmt.Errorf("duplicate subscription name %q", sub.Name)
+		}
+		names[sub.Name] = struct{}{}
+
+		// The URL itself stays out of the error: it usually carries a token.
+		u, err := url.Parse(sub.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("subscription %q: url must be an http or https URL", sub.Name)
+		}
+		interval, err := time.ParseDuration(sub.RefreshInterval)
+		if err != nil || interval < minSubscriptionInterval {
+			return fmt.Errorf("subscription %q: refresh interval must be at least %s", sub.Name, minSubscriptionInterval)
+		}
+	}
 	return nil
 }
 
@@ -269,3 +673,33 @@ func hasFlagArg(args []string, short string, long string) bool {
 	}
 	return false
 }
+
+// validatorCommand splits validator_command into arguments; it returns nil
+// when the validator is disabled.
+func validatorCommand(cfg Config) []string {
+	command := strings.TrimSpace(cfg.ValidatorCommand)
+	if command == validatorDisabled {
+		return nil
+	}
+	return strings.Fields(command)
+}
+
+// subscriptionManager returns nil when no subscriptions are configured.
+func subscriptionManager(cfg Config) *subscription.Manager {
+	if len(cfg.Subscriptions) == 0 {
+		return nil
+	}
+	sources := make([]subscription.Source, 0, len(cfg.Subscriptions))
+	for _, sub := range cfg.Subscriptions {
+		interval, _ := time.ParseDuration(sub.RefreshInterval)
+		sources = append(sources, subscription.Source{Name: sub.Name, URL: sub.URL, Interval: interval})
+	}
+	return subscription.New(cfg.XrayConfigsDir, sources)
+}
+
+func backupStore(cfg Config) *backup.Store {
+	if cfg.BackupCount < 0 {
+		return nil
+	}
+	return backup.New(cfg.BackupDir, cfg.BackupCount)
+}
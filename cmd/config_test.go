@@ -3,8 +3,11 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/handlers"
 )
 
 func TestLoadConfigConsoleDefaults(t *testing.T) {
@@ -28,6 +31,9 @@ func TestLoadConfigConsoleDefaults(t *testing.T) {
 	if cfg.ServiceName != "xray" {
 		t.Fatalf("unexpected service name: %s", cfg.ServiceName)
 	}
+	if cfg.AuditLogPath != "./audit.jsonl" {
+		t.Fatalf("unexpected audit log path: %s", cfg.AuditLogPath)
+	}
 	timeout, err := time.ParseDuration(cfg.LockTimeout)
 	if timeout != 90*time.Second || err != nil {
 		t.Fatalf("unexpected lock timeout: %s", cfg.LockTimeout)
@@ -55,6 +61,9 @@ func TestLoadConfigServiceDefaults(t *testing.T) {
 	if cfg.ConfigPath != "/etc/xray-tlg/config.json" {
 		t.Fatalf("unexpected config path: %s", cfg.ConfigPath)
 	}
+	if cfg.AuditLogPath != "/var/log/xray-tlg/audit.jsonl" {
+		t.Fatalf("unexpected audit log path: %s", cfg.AuditLogPath)
+	}
 }
 
 func TestResolveConfigPathConsole(t *testing.T) {
@@ -138,3 +147,291 @@ func unsetEnv(t *testing.T, key string) {
 		_ = os.Unsetenv(key)
 	})
 }
+
+func TestLoadConfigAllowlistFromEnv(t *testing.T) {
+	unsetEnv(t, "CONFIG")
+	unsetEnv(t, "RUN_MODE")
+	t.Setenv("ALLOWED_USER_IDS", "10,20")
+
+	cfg, err := LoadConfig([]string{"xray-tlg", "--token=test-token", "--allowed-chat-id=-100"})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+
+	if len(cfg.AllowedUserIDs) != 2 || cfg.AllowedUserIDs[0] != 10 || cfg.AllowedUserIDs[1] != 20 {
+		t.Fatalf("unexpected allowed user ids: %v", cfg.AllowedUserIDs)
+	}
+	if len(cfg.AllowedChatIDs) != 1 || cfg.AllowedChatIDs[0] != -100 {
+		t.Fatalf("unexpected allowed chat ids: %v", cfg.AllowedChatIDs)
+	}
+}
+
+func TestLoadConfigRoles(t *testing.T) {
+	unsetEnv(t, "CONFIG")
+	unsetEnv(t, "RUN_MODE")
+	unsetEnv(t, "ROLES")
+	unsetEnv(t, "DEFAULT_ROLE")
+
+	cfg, err := LoadConfig([]string{"xray-tlg", "--token=test-token"})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if cfg.DefaultRole != "admin" {
+		t.Fatalf("expected admin default role without roles, got %s", cfg.DefaultRole)
+	}
+
+	cfg, err = LoadConfig([]string{"xray-tlg", "--token=test-token", "--role=10:admin", "--role=20:operator"})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if cfg.Roles[10] != "admin" || cfg.Roles[20] != "operator" {
+		t.Fatalf("unexpected roles: %v", cfg.Roles)
+	}
+	if cfg.DefaultRole != "viewer" {
+		t.Fatalf("expected viewer default role with roles, got %s", cfg.DefaultRole)
+	}
+
+	if _, err := LoadConfig([]string{"xray-tlg", "--token=test-token", "--role=10:root"}); err == nil {
+		t.Fatal("expected unknown role to fail validation")
+	}
+}
+
+func TestLoadConfigSkipConfirm(t *testing.T) {
+	unsetEnv(t, "CONFIG")
+	unsetEnv(t, "RUN_MODE")
+	t.Setenv("SKIP_CONFIRM", "apply")
+
+	cfg, err := LoadConfig([]string{"xray-tlg", "--token=test-token"})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if len(cfg.SkipConfirm) != 1 || cfg.SkipConfirm[0] != "apply" {
+		t.Fatalf("unexpected skip_confirm: %v", cfg.SkipConfirm)
+	}
+	if cfg.ConfirmTimeout != "60s" {
+		t.Fatalf("unexpected confirm timeout: %s", cfg.ConfirmTimeout)
+	}
+
+	t.Setenv("SKIP_CONFIRM", "speedtest")
+	if _, err := LoadConfig([]string{"xray-tlg", "--token=test-token"}); err == nil {
+		t.Fatal("expected unsupported skip_confirm action to fail validation")
+	}
+}
+
+func TestLoadConfigTokenFile(t *testing.T) {
+	unsetEnv(t, "CONFIG")
+	unsetEnv(t, "RUN_MODE")
+	unsetEnv(t, "TOKEN")
+	unsetEnv(t, "TOKEN_FILE")
+	unsetEnv(t, credentialsDirEnv)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0o600); err != nil {
+		t.Fatalf("write token file failed: %v", err)
+	}
+
+	cfg, err := LoadConfig([]string{"xray-tlg", "--token-file=" + tokenFile})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if cfg.Token != "file-token" {
+		t.Fatalf("unexpected token: %q", cfg.Token)
+	}
+
+	cfg, err = LoadConfig([]string{"xray-tlg", "--token-file=" + tokenFile, "--token=flag-token"})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if cfg.Token != "flag-token" {
+		t.Fatalf("explicit token should win over token file, got %q", cfg.Token)
+	}
+
+	if _, err := LoadConfig([]string{"xray-tlg", "--token-file=" + filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Fatalf("expected error for missing token file")
+	}
+}
+
+func TestLoadConfigTokenFromCredentialsDirectory(t *testing.T) {
+	unsetEnv(t, "CONFIG")
+	unsetEnv(t, "RUN_MODE")
+	unsetEnv(t, "TOKEN")
+	unsetEnv(t, "TOKEN_FILE")
+
+	credentialsDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(credentialsDir, tokenCredentialName), []byte("credential-token"), 0o400); err != nil {
+		t.Fatalf("write credential failed: %v", err)
+	}
+	t.Setenv(credentialsDirEnv, credentialsDir)
+
+	cfg, err := LoadConfig([]string{"xray-tlg"})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if cfg.Token != "credential-token" {
+		t.Fatalf("unexpected token: %q", cfg.Token)
+	}
+}
+
+func TestLoadConfigRateLimitDefaults(t *testing.T) {
+	unsetEnv(t, "CONFIG")
+	unsetEnv(t, "RUN_MODE")
+	unsetEnv(t, "RATE_LIMIT")
+	unsetEnv(t, "RATE_BAN_TIME")
+
+	cfg, err := LoadConfig([]string{"xray-tlg", "--token=test"})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if cfg.RateLimit != 30 || cfg.RateBurst != 10 || cfg.RateBanAfter != 5 || cfg.RateBanTime != "10m" {
+		t.Fatalf("unexpected rate limit defaults: %+v", cfg)
+	}
+
+	cfg, err = LoadConfig([]string{"xray-tlg", "--token=test", "--rate-limit=-1"})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if cfg.RateLimit != -1 {
+		t.Fatalf("expected rate limit to stay disabled, got %d", cfg.RateLimit)
+	}
+
+	if _, err := LoadConfig([]string{"xray-tlg", "--token=test", "--rate-ban-time=soon"}); err == nil {
+		t.Fatalf("expected error for invalid rate ban time")
+	}
+}
+
+func TestLoadConfigUploadMaxSize(t *testing.T) {
+	unsetEnv(t, "CONFIG")
+	unsetEnv(t, "RUN_MODE")
+	unsetEnv(t, "UPLOAD_MAX_SIZE")
+
+	cfg, err := LoadConfig([]string{"xray-tlg", "--token=test"})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if cfg.UploadMaxSize != defaultUploadMaxSize {
+		t.Fatalf("expected default upload max size, got %d", cfg.UploadMaxSize)
+	}
+
+	if _, err := LoadConfig([]string{"xray-tlg", "--token=test", "--upload-max-size=104857600"}); err == nil {
+		t.Fatalf("expected error for upload max size above the Bot API limit")
+	}
+}
+
+func TestLoadConfigPageSize(t *testing.T) {
+	unsetEnv(t, "CONFIG")
+	unsetEnv(t, "RUN_MODE")
+	unsetEnv(t, "CONFIG_PAGE_SIZE")
+
+	cfg, err := LoadConfig([]string{"xray-tlg", "--token=test"})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if cfg.ConfigPageSize != handlers.DefaultPageSize {
+		t.Fatalf("expected default config page size, got %d", cfg.ConfigPageSize)
+	}
+
+	t.Setenv("CONFIG_PAGE_SIZE", "5")
+	cfg, err = LoadConfig([]string{"xray-tlg", "--token=test"})
+	if err != nil || cfg.ConfigPageSize != 5 {
+		t.Fatalf("expected page size from env, got %d, err=%v", cfg.ConfigPageSize, err)
+	}
+
+	if _, err := LoadConfig([]string{"xray-tlg", "--token=test", "--config-page-size=40"}); err == nil {
+		t.Fatalf("expected error for a page size above the keyboard limit")
+	}
+	if _, err := LoadConfig([]string{"xray-tlg", "--token=test", "--config-page-size=-1"}); err == nil {
+		t.Fatalf("expected error for a negative page size")
+	}
+}
+
+func TestLoadConfigSubscriptions(t *testing.T) {
+	unsetEnv(t, "CONFIG")
+	unsetEnv(t, "RUN_MODE")
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	load := func(subscriptions string) (Config, error) {
+		t.Helper()
+		content := `{"token": "json-token", "subscriptions": ` + subscriptions + `}`
+		if err := os.WriteFile(configPath, []byte(content), 0o600); err != nil {
+			t.Fatalf("write config failed: %v", err)
+		}
+		return LoadConfig([]string{"xray-tlg", "--config=" + configPath})
+	}
+
+	cfg, err := load(`[{"name": "provider", "url": "https://sub.example.com/s/token"}, {"name": "backup", "url": "http://example.com/sub", "refresh_interval": "30m"}]`)
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if cfg.Subscriptions[0].RefreshInterval != defaultSubscriptionInterval || cfg.Subscriptions[1].RefreshInterval != "30m" {
+		t.Fatalf("unexpected refresh intervals: %+v", cfg.Subscriptions)
+	}
+	if sources := subscriptionManager(cfg).Sources(); len(sources) != 2 || sources[1].Interval != 30*time.Minute {
+		t.Fatalf("unexpected subscription sources: %+v", sources)
+	}
+
+	rejected := []string{
+		`[{"name": ".trash", "url": "https://example.com/sub"}]`,
+		`[{"name": "a/b", "url": "https://example.com/sub"}]`,
+		`[{"name": "a", "url": "https://example.com/1"}, {"name": "a", "url": "https://example.com/2"}]`,
+		`[{"name": "a", "url": "ftp://example.com/sub"}]`,
+		`[{"name": "a", "url": "https://example.com/sub", "refresh_interval": "10s"}]`,
+	}
+	for _, subscriptions := range rejected {
+		if _, err := load(subscriptions); err == nil {
+			t.Fatalf("expected error for subscriptions %s", subscriptions)
+		}
+	}
+}
+
+func TestLoadConfigBaseTemplate(t *testing.T) {
+	unsetEnv(t, "CONFIG")
+	unsetEnv(t, "RUN_MODE")
+	unsetEnv(t, "BASE_TEMPLATE")
+
+	configsDir := t.TempDir()
+	templatePath := filepath.Join(t.TempDir(), "base.json")
+	if err := os.WriteFile(templatePath, []byte(`{}`), 0o600); err != nil {
+		t.Fatalf("write template failed: %v", err)
+	}
+	insidePath := filepath.Join(configsDir, "base.json")
+	if err := os.WriteFile(insidePath, []byte(`{}`), 0o600); err != nil {
+		t.Fatalf("write template failed: %v", err)
+	}
+
+	args := []string{"xray-tlg", "--token=test", "--xray-configs-dir=" + configsDir}
+	cfg, err := LoadConfig(append(args, "--base-template="+templatePath))
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if cfg.BaseTemplate != templatePath {
+		t.Fatalf("unexpected base template: %s", cfg.BaseTemplate)
+	}
+
+	for _, path := range []string{insidePath, filepath.Join(t.TempDir(), "missing.json")} {
+		if _, err := LoadConfig(append(args, "--base-template="+path)); err == nil {
+			t.Fatalf("expected error for base template %s", path)
+		}
+	}
+}
+
+func TestValidatorCommand(t *testing.T) {
+	unsetEnv(t, "CONFIG")
+	unsetEnv(t, "RUN_MODE")
+	unsetEnv(t, "VALIDATOR_COMMAND")
+
+	cfg, err := LoadConfig([]string{"xray-tlg", "--token=test"})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if got := strings.Join(validatorCommand(cfg), " "); got != "xray run -test -config {config}" {
+		t.Fatalf("unexpected default validator command: %s", got)
+	}
+
+	cfg, err = LoadConfig([]string{"xray-tlg", "--token=test", "--validator-command=none"})
+	if err != nil {
+		t.Fatalf("LoadConfig returned error: %v", err)
+	}
+	if command := validatorCommand(cfg); command != nil {
+		t.Fatalf("expected validator to be disabled, got %v", command)
+	}
+}
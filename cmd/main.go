@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"time"
 
+	"github.com/bonus2k/xray-tlg/internal/audit"
 	"github.com/bonus2k/xray-tlg/internal/handlers"
 	"github.com/bonus2k/xray-tlg/internal/logger"
 	"github.com/bonus2k/xray-tlg/internal/router"
@@ -33,23 +35,88 @@ func main() {
 		_ = appLogger.Sync()
 	}()
 	duration, _ := time.ParseDuration(cfg.LockTimeout)
+	callbackTTL, _ := time.ParseDuration(cfg.CallbackTTL)
+	confirmTimeout, _ := time.ParseDuration(cfg.ConfirmTimeout)
+	rateBanTime, _ := time.ParseDuration(cfg.RateBanTime)
+	validatorTimeout, _ := time.ParseDuration(cfg.ValidatorTimeout)
+	restartGrace, _ := time.ParseDuration(cfg.RestartGrace)
 	appLogger.Info("configuration loaded",
 		zap.String("run_mode", cfg.RunMode),
 		zap.String("config_path", cfg.ConfigPath),
+		zap.String("token_file", cfg.TokenFile),
 		zap.String("xray_configs_dir", cfg.XrayConfigsDir),
 		zap.String("xray_config_path", cfg.XrayConfigPath),
 		zap.String("service_name", cfg.ServiceName),
 		zap.Duration("lock_timeout", duration),
+		zap.Int64s("allowed_user_ids", cfg.AllowedUserIDs),
+		zap.Int64s("allowed_chat_ids", cfg.AllowedChatIDs),
+		zap.Int("roles", len(cfg.Roles)),
+		zap.String("default_role", cfg.DefaultRole),
+		zap.Duration("callback_ttl", callbackTTL),
+		zap.Duration("confirm_timeout", confirmTimeout),
+		zap.Strings("skip_confirm", cfg.SkipConfirm),
+		zap.Int("totp_users", len(cfg.TOTPSecrets)),
+		zap.String("audit_log_path", cfg.AuditLogPath),
+		zap.Int("rate_limit", cfg.RateLimit),
+		zap.Int("rate_burst", cfg.RateBurst),
+		zap.Int("rate_ban_after", cfg.RateBanAfter),
+		zap.Duration("rate_ban_time", rateBanTime),
+		zap.String("validator_command", cfg.ValidatorCommand),
+		zap.Duration("validator_timeout", validatorTimeout),
+		zap.String("backup_dir", cfg.BackupDir),
+		zap.Int("backup_count", cfg.BackupCount),
+		zap.Duration("restart_grace", restartGrace),
+		zap.String("restart_probe", cfg.RestartProbe),
+		zap.String("state_path", cfg.StatePath),
+		zap.Int("upload_max_size", cfg.UploadMaxSize),
+		zap.String("base_template", cfg.BaseTemplate),
+		zap.Int("subscriptions", len(cfg.Subscriptions)),
+		zap.Int64s("notify_chat_ids", cfg.NotifyChatIDs),
+		zap.Int("config_page_size", cfg.ConfigPageSize),
 	)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	handler, err := handlers.NewHandler(cfg.XrayConfigsDir, cfg.XrayConfigPath, cfg.ServiceName, duration, appLogger)
+	auditLog, err := audit.Open(cfg.AuditLogPath)
+	if err != nil {
+		appLogger.Error("audit log init failed", zap.Error(err))
+		os.Exit(1)
+	}
+	defer func() {
+		_ = auditLog.Close()
+	}()
+
+	roles, defaultRole, err := parseRoles(cfg)
+	if err != nil {
+		appLogger.Error("roles init failed", zap.Error(err))
+		os.Exit(1)
+	}
+
+	handler, err := handlers.NewHandler(cfg.XrayConfigsDir, cfg.XrayConfigPath, cfg.ServiceName, duration, appLogger,
+		handlers.WithAccessControl(cfg.AllowedUserIDs, cfg.AllowedChatIDs),
+		handlers.WithRoles(roles, defaultRole),
+		handlers.WithCallbackSigning(cfg.CallbackSecret, callbackTTL),
+		handlers.WithConfirmation(confirmTimeout, cfg.SkipConfirm),
+		handlers.WithTOTP(cfg.TOTPSecrets),
+		handlers.WithRateLimit(cfg.RateLimit, cfg.RateBurst, cfg.RateBanAfter, rateBanTime),
+		handlers.WithAuditLog(auditLog),
+		handlers.WithValidator(validatorCommand(cfg), validatorTimeout),
+		handlers.WithBackups(backupStore(cfg)),
+		handlers.WithRestartCheck(restartGrace, cfg.RestartProbe),
+		handlers.WithStateFile(cfg.StatePath),
+		handlers.WithUploads(cfg.UploadMaxSize),
+		handlers.WithSubscriptions(subscriptionManager(cfg), cfg.NotifyChatIDs),
+		handlers.WithTemplate(cfg.BaseTemplate),
+		handlers.WithPageSize(cfg.ConfigPageSize),
+	)
 	if err != nil {
 		appLogger.Error("handler init failed", zap.Error(err))
 		os.Exit(1)
 	}
+	if !handler.AccessControlEnabled() {
+		appLogger.Warn("access control is disabled: any Telegram user can control the bot, set allowed_user_ids or allowed_chat_ids")
+	}
 
 	opts := router.GetRouter(handler)
 
@@ -59,11 +126,30 @@ func main() {
 		os.Exit(1)
 	}
 
+	go handler.RunSubscriptions(ctx, telegramBot)
+
 	appLogger.Info("bot started")
 	telegramBot.Start(ctx)
 	appLogger.Info("bot stopped")
 }
 
+func parseRoles(cfg Config) (map[int64]handlers.Role, handlers.Role, error) {
+	defaultRole, err := handlers.ParseRole(cfg.DefaultRole)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	roles := make(map[int64]handlers.Role, len(cfg.Roles))
+	for userID, value := range cfg.Roles {
+		role, err := handlers.ParseRole(value)
+		if err != nil {
+			return nil, 0, fmt.Errorf("role for user %d: %w", userID, err)
+		}
+		roles[userID] = role
+	}
+	return roles, defaultRole, nil
+}
+
 func exitWithBootstrapError(message string, err error) {
 	bootstrapLogger, loggerErr := logger.New("error")
 	if loggerErr != nil {
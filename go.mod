@@ -6,6 +6,7 @@ require (
 	github.com/go-telegram/bot v1.19.0
 	github.com/jessevdk/go-flags v1.6.1
 	github.com/showwin/speedtest-go v1.7.10
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 )
 
 require go.uber.org/multierr v1.10.0 // indirect
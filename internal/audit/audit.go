@@ -0,0 +1,141 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	OutcomeOK       = "ok"
+	OutcomeError    = "error"
+	OutcomeDenied   = "denied"
+	OutcomeRejected = "rejected"
+	OutcomeExpired  = "expired"
+	OutcomeBusy     = "busy"
+	OutcomePending  = "pending"
+)
+
+type Entry struct {
+	Time       time.Time `json:"time"`
+	UserID     int64     `json:"user_id"`
+	Username   string    `json:"username,omitempty"`
+	ChatID     int64     `json:"chat_id"`
+	Action     string    `json:"action"`
+	Args       []string  `json:"args,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// Log is an append-only JSONL file. Entries are never rewritten; reading
+// pages scans the file from the start, which is fine for bot-sized logs.
+type Log struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+func Open(path string) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("create audit log dir: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+
+	return &Log{path: path, file: file}, nil
+}
+
+func (l *Log) Append(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	entry.Time = entry.Time.UTC()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encode audit entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, err := l.file.Write(line); err != nil {
+		return fmt.Errorf("write audit entry: %w", err)
+	}
+	return nil
+}
+
+// Page returns entries newest first. Page 0 holds the latest entries.
+func (l *Log) Page(page, size int) ([]Entry, int, error) {
+	if page < 0 || size <= 0 {
+		return nil, 0, errors.New("invalid audit page")
+	}
+
+	l.mutex.Lock()
+	data, err := os.ReadFile(l.path)
+	l.mutex.Unlock()
+	if err != nil {
+		return nil, 0, fmt.Errorf("read audit log: %w", err)
+	}
+
+	entries, err := decodeEntries(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := len(entries)
+	end := total - page*size
+	if end <= 0 {
+		return nil, total, nil
+	}
+	start := max(end-size, 0)
+
+	result := make([]Entry, 0, end-start)
+	for i := end - 1; i >= start; i-- {
+		result = append(result, entries[i])
+	}
+	return result, total, nil
+}
+
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.file.Close()
+}
+
+func decodeEntries(reader io.Reader) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// A torn last line after a crash must not hide the rest of the log.
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan audit log: %w", err)
+	}
+	return entries, nil
+}
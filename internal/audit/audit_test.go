@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogAppendAndPage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer func() {
+		_ = log.Close()
+	}()
+
+	for _, action := range []string{"a1", "a2", "a3", "a4", "a5"} {
+		if err := log.Append(Entry{UserID: 1, Action: action, Outcome: OutcomeOK}); err != nil {
+			t.Fatalf("Append returned error: %v", err)
+		}
+	}
+
+	entries, total, err := log.Page(0, 2)
+	if err != nil {
+		t.Fatalf("Page returned error: %v", err)
+	}
+	if total != 5 || len(entries) != 2 || entries[0].Action != "a5" || entries[1].Action != "a4" {
+		t.Fatalf("unexpected first page: total=%d entries=%+v", total, entries)
+	}
+
+	entries, _, err = log.Page(2, 2)
+	if err != nil {
+		t.Fatalf("Page returned error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Action != "a1" {
+		t.Fatalf("unexpected last page: %+v", entries)
+	}
+
+	entries, _, err = log.Page(3, 2)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected empty page past the end, got %+v, err=%v", entries, err)
+	}
+}
+
+func TestLogSkipsTornLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	if err := os.WriteFile(path, []byte("{\"action\":\"ok\"}\n{\"action\":"), 0o600); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	log, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer func() {
+		_ = log.Close()
+	}()
+
+	entries, total, err := log.Page(0, 10)
+	if err != nil || total != 1 || entries[0].Action != "ok" {
+		t.Fatalf("unexpected entries: %+v, total=%d, err=%v", entries, total, err)
+	}
+}
@@ -0,0 +1,255 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// idLayout doubles as the file name of a backup, so IDs sort by time and
+	// can be checked before they are joined onto the backup dir.
+	idLayout      = "20060102T150405.000Z"
+	configSuffix  = ".json"
+	metaSuffix    = ".meta"
+	DefaultKeep   = 10
+	backupDirMode = 0o750
+	// knownGoodID names the copy of the config the service last ran with
+	// after a passed health check. It does not parse as a backup ID, so it is
+	// neither listed nor pruned.
+	knownGoodID = "known-good"
+)
+
+var ErrNotFound = errors.New("backup not found")
+
+type Entry struct {
+	ID         string    `json:"id"`
+	Time       time.Time `json:"time"`
+	Source     string    `json:"source,omitempty"`
+	ReplacedBy string    `json:"replaced_by,omitempty"`
+	UserID     int64     `json:"user_id,omitempty"`
+	Username   string    `json:"username,omitempty"`
+}
+
+// Store keeps copies of the active config taken right before it is
+// replaced. Only the newest keep backups are retained.
+type Store struct {
+	mutex sync.Mutex
+	dir   string
+	keep  int
+	now   func() time.Time
+}
+
+func New(dir string, keep int) *Store {
+	if keep <= 0 {
+		keep = DefaultKeep
+	}
+	return &Store{dir: dir, keep: keep, now: time.Now}
+}
+
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Save copies activePath into the store. A missing active file is not an
+// error: there is simply nothing to back up yet.
+func (s *Store) Save(activePath string, entry Entry) (Entry, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	source, err := os.Open(activePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("open active config: %w", err)
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+
+	if err := os.MkdirAll(s.dir, backupDirMode); err != nil {
+		return Entry{}, false, fmt.Errorf("create backup dir: %w", err)
+	}
+
+	entry.Time = s.now().UTC()
+	entry.ID = entry.Time.Format(idLayout)
+	for s.exists(entry.ID) {
+		entry.Time = entry.Time.Add(time.Millisecond)
+		entry.ID = entry.Time.Format(idLayout)
+	}
+
+	if err := writeFile(filepath.Join(s.dir, entry.ID+configSuffix), source); err != nil {
+		return Entry{}, false, err
+	}
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, false, fmt.Errorf("encode backup meta: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, entry.ID+metaSuffix), meta, 0o600); err != nil {
+		return Entry{}, false, fmt.Errorf("write backup meta: %w", err)
+	}
+
+	if err := s.prune(); err != nil {
+		return entry, true, err
+	}
+	return entry, true, nil
+}
+
+// List returns backups newest first.
+func (s *Store) List() ([]Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.list()
+}
+
+// Get returns the backup and the path of its config copy.
+func (s *Store) Get(id string) (Entry, string, error) {
+	if _, err := time.Parse(idLayout, id); err != nil {
+		return Entry{}, "", fmt.Errorf("%w: %q", ErrNotFound, id)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.exists(id) {
+		return Entry{}, "", fmt.Errorf("%w: %q", ErrNotFound, id)
+	}
+	return s.readEntry(id), filepath.Join(s.dir, id+configSuffix), nil
+}
+
+// MarkKnownGood copies activePath as the config the service is known to run
+// with, replacing the previous one.
+func (s *Store) MarkKnownGood(activePath string, entry Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	source, err := os.Open(activePath)
+	if err != nil {
+		return fmt.Errorf("open active config: %w", err)
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+
+	if err := os.MkdirAll(s.dir, backupDirMode); err != nil {
+		return fmt.Errorf("create backup dir: %w", err)
+	}
+	entry.ID = knownGoodID
+	entry.Time = s.now().UTC()
+	if err := writeFile(filepath.Join(s.dir, knownGoodID+configSuffix), source); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encode backup meta: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, knownGoodID+metaSuffix), meta, 0o600); err != nil {
+		return fmt.Errorf("write backup meta: %w", err)
+	}
+	return nil
+}
+
+// KnownGood returns the config last marked with MarkKnownGood and the path of
+// its copy, or ErrNotFound when no restart has passed the health check yet.
+func (s *Store) KnownGood() (Entry, string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.exists(knownGoodID) {
+		return Entry{}, "", ErrNotFound
+	}
+	return s.readEntry(knownGoodID), filepath.Join(s.dir, knownGoodID+configSuffix), nil
+}
+
+func (s *Store) list() ([]Entry, error) {
+	dirEntries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read backup dir: %w", err)
+	}
+
+	var ids []string
+	for _, dirEntry := range dirEntries {
+		id, ok := strings.CutSuffix(dirEntry.Name(), configSuffix)
+		if !ok || dirEntry.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(idLayout, id); err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+
+	entries := make([]Entry, 0, len(ids))
+	for _, id := range ids {
+		entries = append(entries, s.readEntry(id))
+	}
+	return entries, nil
+}
+
+// readEntry falls back to the time encoded in the ID when the meta file is
+// missing or damaged, so a backup stays restorable.
+func (s *Store) readEntry(id string) Entry {
+	entry := Entry{}
+	if data, err := os.ReadFile(filepath.Join(s.dir, id+metaSuffix)); err == nil {
+		_ = json.Unmarshal(data, &entry)
+	}
+	entry.ID = id
+	if entry.Time.IsZero() {
+		entry.Time, _ = time.Parse(idLayout, id)
+	}
+	return entry
+}
+
+func (s *Store) exists(id string) bool {
+	_, err := os.Stat(filepath.Join(s.dir, id+configSuffix))
+	return err == nil
+}
+
+func (s *Store) prune() error {
+	entries, err := s.list()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries[min(len(entries), s.keep):] {
+		for _, suffix := range []string{configSuffix, metaSuffix} {
+			if err := os.Remove(filepath.Join(s.dir, entry.ID+suffix)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("remove old backup: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func writeFile(path string, source io.Reader) error {
+	tempPath := path + ".tmp"
+	file, err := os.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("create backup file: %w", err)
+	}
+	if _, err := io.Copy(file, source); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("write backup file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("close backup file: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("store backup file: %w", err)
+	}
+	return nil
+}
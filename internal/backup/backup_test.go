@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveListAndPrune(t *testing.T) {
+	dir := t.TempDir()
+	active := filepath.Join(dir, "config.json")
+	store := New(filepath.Join(dir, "backups"), 2)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	if _, saved, err := store.Save(active, Entry{}); err != nil || saved {
+		t.Fatalf("expected missing active config to be skipped: saved=%v err=%v", saved, err)
+	}
+
+	for i, content := range []string{"first", "second", "third"} {
+		if err := os.WriteFile(active, []byte(content), 0o644); err != nil {
+			t.Fatalf("write active config failed: %v", err)
+		}
+		if _, saved, err := store.Save(active, Entry{Source: content + ".json", UserID: int64(i)}); err != nil || !saved {
+			t.Fatalf("Save returned saved=%v err=%v", saved, err)
+		}
+	}
+
+	entries, err := store.List()
+	if err != nil {
+		t.Fatalf("List returned error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Source != "third.json" || entries[1].Source != "second.json" {
+		t.Fatalf("unexpected backups: %+v", entries)
+	}
+
+	_, path, err := store.Get(entries[1].ID)
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "second" {
+		t.Fatalf("unexpected backup content %q: %v", data, err)
+	}
+}
+
+func TestGetRejectsUnknownIDs(t *testing.T) {
+	store := New(t.TempDir(), 2)
+	for _, id := range []string{"../config", "20261016T120000.000Z"} {
+		if _, _, err := store.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get(%q) returned %v, want ErrNotFound", id, err)
+		}
+	}
+}
+
+func TestKnownGood(t *testing.T) {
+	dir := t.TempDir()
+	active := filepath.Join(dir, "config.json")
+	store := New(filepath.Join(dir, "backups"), 1)
+
+	if _, _, err := store.KnownGood(); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound before any mark, got %v", err)
+	}
+
+	for _, content := range []string{"first", "second"} {
+		if err := os.WriteFile(active, []byte(content), 0o644); err != nil {
+			t.Fatalf("write active config failed: %v", err)
+		}
+		if err := store.MarkKnownGood(active, Entry{Source: content + ".json"}); err != nil {
+			t.Fatalf("MarkKnownGood returned error: %v", err)
+		}
+		if _, _, err := store.Save(active, Entry{}); err != nil {
+			t.Fatalf("Save returned error: %v", err)
+		}
+	}
+
+	entry, path, err := store.KnownGood()
+	if err != nil || entry.Source != "second.json" {
+		t.Fatalf("unexpected known good config: %+v, err=%v", entry, err)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "second" {
+		t.Fatalf("unexpected known good content %q: %v", data, err)
+	}
+	if entries, err := store.List(); err != nil || len(entries) != 1 {
+		t.Fatalf("known good config must not be listed or pruned as a backup: %+v, err=%v", entries, err)
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	accessDeniedText = "⛔ You are not allowed to use this bot."
+	actionAccess     = "access"
+)
+
+func WithAccessControl(userIDs, chatIDs []int64) Option {
+	return func(h *Handler) {
+		h.allowedUserIDs = makeIDSet(userIDs)
+		h.allowedChatIDs = makeIDSet(chatIDs)
+	}
+}
+
+func (h *Handler) AccessControlEnabled() bool {
+	return len(h.allowedUserIDs) > 0 || len(h.allowedChatIDs) > 0
+}
+
+// Middlewares returns the update middlewares, outermost first. Rate limiting
+// runs before access control, so a stranger's flood is throttled before
+// every update is logged, audited and answered as a denial.
+func (h *Handler) Middlewares() []bot.Middleware {
+	return []bot.Middleware{h.RateLimitMiddleware, h.AccessMiddleware}
+}
+
+func (h *Handler) AccessMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		sender, ok := getUpdateSender(update)
+		if !ok {
+			// Edited messages, chat member changes and channel posts have no
+			// sender to check and no handler; they are not security events.
+			return
+		}
+		if h.isAllowed(sender.userID, sender.chatID) {
+			next(ctx, b, update)
+			return
+		}
+
+		h.logger.Warn("unauthorized update rejected",
+			zap.Int64("user_id", sender.userID),
+			zap.String("username", sender.username),
+			zap.Int64("chat_id", sender.chatID),
+		)
+		h.recordAudit(audit.Entry{
+			UserID:   sender.userID,
+			Username: sender.username,
+			ChatID:   sender.chatID,
+			Action:   actionAccess,
+			Outcome:  audit.OutcomeDenied,
+		})
+		h.rejectUnauthorized(ctx, b, update, sender)
+	}
+}
+
+func (h *Handler) isAllowed(userID, chatID int64) bool {
+	if len(h.allowedUserIDs) > 0 {
+		if _, ok := h.allowedUserIDs[userID]; !ok {
+			return false
+		}
+	}
+	if len(h.allowedChatIDs) > 0 {
+		if _, ok := h.allowedChatIDs[chatID]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *Handler) rejectUnauthorized(ctx context.Context, b *bot.Bot, update *models.Update, sender updateSender) {
+	if update == nil {
+		return
+	}
+
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			ShowAlert:       true,
+			Text:            accessDeniedText,
+		}); err != nil {
+			h.logger.Warn("send access denied alert failed", zap.Error(err), zap.Int64("user_id", sender.userID))
+		}
+		return
+	}
+
+	// Replying in groups would let anyone make the bot spam the chat, so
+	// unauthorized group messages are dropped silently.
+	if update.Message == nil || update.Message.Chat.Type != models.ChatTypePrivate {
+		return
+	}
+
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: sender.chatID, Text: accessDeniedText}); err != nil {
+		h.logger.Warn("send access denied message failed", zap.Error(err), zap.Int64("chat_id", sender.chatID))
+	}
+}
+
+type updateSender struct {
+	userID   int64
+	username string
+	chatID   int64
+}
+
+func getUpdateSender(update *models.Update) (updateSender, bool) {
+	if update == nil {
+		return updateSender{}, false
+	}
+
+	if callback := update.CallbackQuery; callback != nil {
+		sender := updateSender{userID: callback.From.ID, username: callback.From.Username}
+		if callback.Message.Message != nil {
+			sender.chatID = callback.Message.Message.Chat.ID
+		} else if callback.Message.InaccessibleMessage != nil {
+			sender.chatID = callback.Message.InaccessibleMessage.Chat.ID
+		}
+		return sender, sender.userID != 0 && sender.chatID != 0
+	}
+
+	if message := update.Message; message != nil {
+		sender := updateSender{chatID: message.Chat.ID}
+		if message.From != nil {
+			sender.userID = message.From.ID
+			sender.username = message.From.Username
+		}
+		return sender, sender.userID != 0
+	}
+
+	return updateSender{}, false
+}
+
+func makeIDSet(ids []int64) map[int64]struct{} {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	set := make(map[int64]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+	return set
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+func TestIsAllowed(t *testing.T) {
+	h := &Handler{logger: zap.NewNop()}
+	if !h.isAllowed(1, 1) {
+		t.Fatal("expected everyone to be allowed without allowlists")
+	}
+
+	WithAccessControl([]int64{10}, []int64{-100})(h)
+
+	if !h.isAllowed(10, -100) {
+		t.Fatal("expected allowlisted user in allowlisted chat to be allowed")
+	}
+	if h.isAllowed(11, -100) {
+		t.Fatal("expected unknown user to be rejected")
+	}
+	if h.isAllowed(10, -200) {
+		t.Fatal("expected unknown chat to be rejected")
+	}
+}
+
+func TestGetUpdateSender(t *testing.T) {
+	update := &models.Update{
+		CallbackQuery: &models.CallbackQuery{
+			From: models.User{ID: 42, Username: "alice"},
+			Message: models.MaybeInaccessibleMessage{
+				Type:    models.MaybeInaccessibleMessageTypeMessage,
+				Message: &models.Message{Chat: models.Chat{ID: 7}},
+			},
+		},
+	}
+
+	sender, ok := getUpdateSender(update)
+	if !ok || sender.userID != 42 || sender.chatID != 7 || sender.username != "alice" {
+		t.Fatalf("unexpected callback sender: %+v, ok=%v", sender, ok)
+	}
+
+	if _, ok := getUpdateSender(&models.Update{Message: &models.Message{Chat: models.Chat{ID: 7}}}); ok {
+		t.Fatal("expected message without sender to be rejected")
+	}
+}
+
+func TestAccessMiddlewareDropsUpdatesWithoutSender(t *testing.T) {
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("audit.Open returned error: %v", err)
+	}
+	defer func() {
+		_ = log.Close()
+	}()
+	h := &Handler{logger: zap.NewNop(), audit: log}
+	WithAccessControl([]int64{10}, nil)(h)
+
+	called := false
+	next := h.AccessMiddleware(func(context.Context, *bot.Bot, *models.Update) { called = true })
+	next(context.Background(), nil, &models.Update{EditedMessage: &models.Message{From: &models.User{ID: 10}, Chat: models.Chat{ID: 10}}})
+	next(context.Background(), nil, &models.Update{MyChatMember: &models.ChatMemberUpdated{}})
+
+	if called {
+		t.Fatal("updates without a sender must not reach the handlers")
+	}
+	if _, total, err := log.Page(0, 10); err != nil || total != 0 {
+		t.Fatalf("updates without a sender must not be audited, got %d entries, err=%v", total, err)
+	}
+}
+
+func TestStrangerFloodIsRateLimitedBeforeAccessControl(t *testing.T) {
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("audit.Open returned error: %v", err)
+	}
+	defer func() {
+		_ = log.Close()
+	}()
+	h := &Handler{logger: zap.NewNop(), audit: log}
+	WithAccessControl([]int64{10}, nil)(h)
+	WithRateLimit(60, 2, 0, 0)(h)
+
+	// Applied the way go-telegram/bot does: the first middleware is outermost.
+	handler := bot.HandlerFunc(func(context.Context, *bot.Bot, *models.Update) {
+		t.Fatal("a stranger's update must not reach the handlers")
+	})
+	middlewares := h.Middlewares()
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	stranger := &models.Update{Message: &models.Message{
+		From: &models.User{ID: 99},
+		Chat: models.Chat{ID: -100, Type: models.ChatTypeGroup},
+	}}
+	for range 10 {
+		handler(context.Background(), nil, stranger)
+	}
+
+	entries, _, err := log.Page(0, 100)
+	if err != nil {
+		t.Fatalf("read audit log failed: %v", err)
+	}
+	denials := 0
+	for _, entry := range entries {
+		if entry.Action == actionAccess {
+			denials++
+		}
+	}
+	if denials != 2 {
+		t.Fatalf("expected only the burst to reach access control, got %d denials in %+v", denials, entries)
+	}
+}
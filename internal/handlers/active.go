@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const activeTimeLayout = "2006-01-02 15:04 UTC"
+
+// activeState remembers what the bot last put into xrayConfigPath. It is
+// only trusted while the hash still matches the file on disk.
+type activeState struct {
+	Name      string    `json:"name"`
+	SHA256    string    `json:"sha256"`
+	AppliedAt time.Time `json:"applied_at"`
+	UserID    int64     `json:"user_id,omitempty"`
+	Username  string    `json:"username,omitempty"`
+}
+
+type activeConfig struct {
+	name string
+	// applied is set when the bot itself applied the current content.
+	applied *activeState
+	// unknown is set when the active file exists but matches no profile.
+	unknown bool
+}
+
+func WithStateFile(path string) Option {
+	return func(h *Handler) {
+		h.statePath = path
+	}
+}
+
+func (h *Handler) rememberActiveConfig(req callbackRequest, name string) {
+	if h.statePath == "" {
+		return
+	}
+
+	sum, err := fileSHA256(h.xrayConfigPath)
+	if err != nil {
+		h.logger.Warn("hash active config failed", zap.Error(err))
+		return
+	}
+	state := activeState{
+		Name:      name,
+		SHA256:    sum,
+		AppliedAt: time.Now().UTC(),
+		UserID:    req.userID,
+		Username:  req.username,
+	}
+	if err := writeActiveState(h.statePath, state); err != nil {
+		h.logger.Warn("save active config state failed", zap.Error(err), zap.String("path", h.statePath))
+	}
+}
+
+// activeConfig identifies the live profile: first by the remembered state,
+// then by comparing content hashes with the files in xrayConfigsDir.
+func (h *Handler) activeConfig() activeConfig {
+	sum, err := fileSHA256(h.xrayConfigPath)
+	if err != nil {
+		return activeConfig{}
+	}
+
+	if state, err := readActiveState(h.statePath); err == nil && state.SHA256 == sum {
+		return activeConfig{name: state.Name, applied: &state}
+	}
+
+	if name := h.detectConfigSource(h.xrayConfigPath); name != "" {
+		return activeConfig{name: name}
+	}
+	return activeConfig{unknown: true}
+}
+
+func (a activeConfig) describe() string {
+	switch {
+	case a.applied != nil:
+		text := fmt.Sprintf("Active: %s (applied at %s", a.name, a.applied.AppliedAt.UTC().Format(activeTimeLayout))
+		if by := describeUser(a.applied.UserID, a.applied.Username); by != "" {
+			text += " by " + by
+		}
+		return text + ")"
+	case a.name != "":
+		return "Active: " + a.name
+	case a.unknown:
+		return "Active: unknown, changed outside the bot"
+	default:
+		return "Active: none"
+	}
+}
+
+func (h *Handler) mainMenuText(greeting string) string {
+	return fmt.Sprintf("%s\n\n%s", h.activeConfig().describe(), greeting)
+}
+
+// detectConfigSource returns the name of the profile with the same content
+// as path, or "" when none matches. Snippets are compared after merging
+// them into the base template. Profile hashes are cached by the registry,
+// so only profiles changed since the last call are read.
+func (h *Handler) detectConfigSource(path string) string {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return ""
+	}
+	entries, err := h.registry.list()
+	if err != nil {
+		return ""
+	}
+	var template fileStamp
+	if h.templatePath != "" {
+		template = statFile(h.templatePath)
+	}
+	for _, entry := range entries {
+		profileSum, err := h.registry.profileSum(entry.Name, template, func() (string, error) {
+			data, err := h.readProfile(filepath.Join(h.xrayConfigsDir, filepath.FromSlash(entry.Name)))
+			if err != nil {
+				return "", err
+			}
+			return dataSHA256(data), nil
+		})
+		if err == nil && profileSum == sum {
+			return entry.Name
+		}
+	}
+	return ""
+}
+
+func fileSHA256(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return dataSHA256(data), nil
+}
+
+func dataSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func readActiveState(path string) (activeState, error) {
+	if path == "" {
+		return activeState{}, errors.New("state file is not configured")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return activeState{}, err
+	}
+	var state activeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return activeState{}, fmt.Errorf("decode active config state: %w", err)
+	}
+	return state, nil
+}
+
+func writeActiveState(path string, state activeState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode active config state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("create state dir: %w", err)
+	}
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0o600); err != nil {
+		return fmt.Errorf("write active config state: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return fmt.Errorf("replace active config state: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestActiveConfig(t *testing.T) {
+	configsDir := t.TempDir()
+	activePath := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, filepath.Join(configsDir, "client-eu.json"), "eu")
+	writeTestFile(t, filepath.Join(configsDir, "client-eu-copy.json"), "eu")
+	writeTestFile(t, filepath.Join(configsDir, "client-us.json"), "us")
+
+	h := &Handler{
+		xrayConfigsDir: configsDir,
+		xrayConfigPath: activePath,
+		logger:         zap.NewNop(),
+		registry:       newConfigRegistry(configsDir),
+		statePath:      filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	if got := h.activeConfig().describe(); got != "Active: none" {
+		t.Fatalf("unexpected description without active config: %s", got)
+	}
+
+	writeTestFile(t, activePath, "us")
+	if got := h.activeConfig().describe(); got != "Active: client-us.json" {
+		t.Fatalf("expected hash match, got %s", got)
+	}
+
+	writeTestFile(t, activePath, "eu")
+	h.rememberActiveConfig(callbackRequest{userID: 1, username: "alice"}, "client-eu.json")
+	got := h.activeConfig().describe()
+	if !strings.HasPrefix(got, "Active: client-eu.json (applied at ") || !strings.HasSuffix(got, " by @alice)") {
+		t.Fatalf("expected remembered name to win over identical copies, got %s", got)
+	}
+
+	writeTestFile(t, activePath, "edited by hand")
+	if got := h.activeConfig().describe(); got != "Active: unknown, changed outside the bot" {
+		t.Fatalf("expected stale state to be ignored, got %s", got)
+	}
+
+	writeTestFile(t, activePath, "eu")
+	text := formatConfigListText([]configEntry{{Name: "client-eu.json"}, {Name: "client-us.json"}}, h.activeConfig().name)
+	if !strings.Contains(text, "client-eu.json ✅") || strings.Contains(text, "client-us.json ✅") {
+		t.Fatalf("unexpected list text: %s", text)
+	}
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const auditPageSize = 10
+
+// auditNote lets a command add details to its own audit entry, e.g. the
+// resolved file name, or override the outcome when it only asked a question.
+type auditNote struct {
+	args    []string
+	outcome string
+}
+
+func WithAuditLog(log *audit.Log) Option {
+	return func(h *Handler) {
+		h.audit = log
+	}
+}
+
+func (r callbackRequest) annotate(args ...string) {
+	if r.audit != nil {
+		r.audit.args = append(r.audit.args, args...)
+	}
+}
+
+func (r callbackRequest) markOutcome(outcome string) {
+	if r.audit != nil {
+		r.audit.outcome = outcome
+	}
+}
+
+func (h *Handler) recordAudit(entry audit.Entry) {
+	if h.audit == nil {
+		return
+	}
+	if err := h.audit.Append(entry); err != nil {
+		h.logger.Error("audit log append failed", zap.Error(err), zap.String("action", entry.Action))
+	}
+}
+
+func (h *Handler) recordCallbackAudit(req callbackRequest, action, outcome string, err error, started time.Time) {
+	entry := audit.Entry{
+		Time:       started,
+		UserID:     req.userID,
+		Username:   req.username,
+		ChatID:     req.chatID,
+		Action:     action,
+		Args:       append([]string(nil), req.args...),
+		Outcome:    outcome,
+		DurationMS: time.Since(started).Milliseconds(),
+	}
+	if req.audit != nil {
+		entry.Args = append(entry.Args, req.audit.args...)
+		if req.audit.outcome != "" && outcome == audit.OutcomeOK {
+			entry.Outcome = req.audit.outcome
+		}
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	h.recordAudit(entry)
+}
+
+func (h *Handler) AuditHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	sender, ok := getUpdateSender(update)
+	if !ok || update.Message == nil {
+		return
+	}
+
+	started := time.Now()
+	req := callbackRequest{
+		chatID:   sender.chatID,
+		userID:   sender.userID,
+		username: sender.username,
+		role:     h.roleFor(sender.userID),
+	}
+
+	if !req.role.Can(actionAuditLog) {
+		h.logger.Warn("audit log rejected by role", zap.Int64("user_id", req.userID), zap.Stringer("role", req.role))
+		h.recordCallbackAudit(req, actionAuditLog, audit.OutcomeDenied, nil, started)
+		h.sendText(ctx, b, req.chatID, fmt.Sprintf("⛔ Your role (%s) does not allow this action.", req.role))
+		return
+	}
+
+	text, keyboard, err := h.renderAuditPage(0)
+	if err == nil {
+		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      req.chatID,
+			Text:        text,
+			ReplyMarkup: keyboard,
+		})
+	}
+	if err != nil {
+		h.logger.Error("send audit log failed", zap.Error(err), zap.Int64("chat_id", req.chatID))
+		h.recordCallbackAudit(req, actionAuditLog, audit.OutcomeError, err, started)
+		return
+	}
+	h.recordCallbackAudit(req, actionAuditLog, audit.OutcomeOK, nil, started)
+}
+
+func (h *Handler) AuditPageHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionAuditLog, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		if len(req.args) != 1 {
+			return fmt.Errorf("audit page callback expects 1 argument, got %d", len(req.args))
+		}
+		page, err := strconv.Atoi(req.args[0])
+		if err != nil || page < 0 {
+			return fmt.Errorf("invalid audit page %q", req.args[0])
+		}
+
+		text, keyboard, err := h.renderAuditPage(page)
+		if err != nil {
+			return err
+		}
+
+		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      req.chatID,
+			MessageID:   req.messageID,
+			Text:        text,
+			ReplyMarkup: keyboard,
+		}); err != nil {
+			return fmt.Errorf("edit audit page message: %w", err)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) renderAuditPage(page int) (string, *models.InlineKeyboardMarkup, error) {
+	if h.audit == nil {
+		return "📜 Audit log is disabled.", nil, nil
+	}
+
+	pageSize := auditPageSize
+	entries, total, err := h.audit.Page(page, pageSize)
+	if err != nil {
+		return "", nil, err
+	}
+
+	pages := max((total+pageSize-1)/pageSize, 1)
+	text := formatAuditEntries(entries, page, pages)
+
+	navigation := make([]models.InlineKeyboardButton, 0, 2)
+	if page+1 < pages {
+		navigation = append(navigation, models.InlineKeyboardButton{Text: "◀️ Older", CallbackData: h.callbacks.encode(CallbackAuditPage, strconv.Itoa(page+1))})
+	}
+	if page > 0 {
+		navigation = append(navigation, models.InlineKeyboardButton{Text: "Newer ▶️", CallbackData: h.callbacks.encode(CallbackAuditPage, strconv.Itoa(page-1))})
+	}
+
+	buttons := make([][]models.InlineKeyboardButton, 0, 2)
+	if len(navigation) > 0 {
+		buttons = append(buttons, navigation)
+	}
+	buttons = append(buttons, []models.InlineKeyboardButton{{Text: "⬅️ Back to Main Menu", CallbackData: h.callbacks.encode(CallbackMainMenu)}})
+
+	return text, &models.InlineKeyboardMarkup{InlineKeyboard: buttons}, nil
+}
+
+func formatAuditEntries(entries []audit.Entry, page, pages int) string {
+	if len(entries) == 0 {
+		return "📜 Audit log is empty."
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "📜 Audit log, page %d/%d (newest first):", page+1, pages)
+	for _, entry := range entries {
+		user := strconv.FormatInt(entry.UserID, 10)
+		if entry.Username != "" {
+			user = "@" + entry.Username + " (" + user + ")"
+		}
+
+		fmt.Fprintf(&builder, "\n\n%s · %s\n%s → %s, %dms",
+			entry.Time.UTC().Format("2006-01-02 15:04:05"),
+			user,
+			entry.Action,
+			entry.Outcome,
+			entry.DurationMS,
+		)
+		if len(entry.Args) > 0 {
+			builder.WriteString("\nargs: " + strings.Join(entry.Args, " "))
+		}
+		if entry.Error != "" {
+			builder.WriteString("\nerror: " + truncateText(entry.Error, 200))
+		}
+	}
+	return builder.String()
+}
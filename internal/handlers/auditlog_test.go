@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"go.uber.org/zap"
+)
+
+func TestRecordCallbackAudit(t *testing.T) {
+	log, err := audit.Open(filepath.Join(t.TempDir(), "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("audit.Open returned error: %v", err)
+	}
+	defer func() {
+		_ = log.Close()
+	}()
+
+	h := &Handler{logger: zap.NewNop(), audit: log}
+	req := callbackRequest{userID: 1, username: "alice", chatID: 2, args: []string{"id"}, audit: &auditNote{}}
+	req.annotate("file=client-eu.json")
+	req.markOutcome(audit.OutcomePending)
+
+	h.recordCallbackAudit(req, actionCopyConfig, audit.OutcomeOK, nil, time.Now())
+	h.recordCallbackAudit(callbackRequest{userID: 1}, actionRestartService, audit.OutcomeError, errors.New("boom"), time.Now())
+
+	entries, total, err := log.Page(0, 10)
+	if err != nil || total != 2 {
+		t.Fatalf("unexpected page: total=%d, err=%v", total, err)
+	}
+
+	failed, applied := entries[0], entries[1]
+	if failed.Outcome != audit.OutcomeError || failed.Error != "boom" {
+		t.Fatalf("unexpected failed entry: %+v", failed)
+	}
+	if applied.Outcome != audit.OutcomePending || applied.Username != "alice" || strings.Join(applied.Args, " ") != "id file=client-eu.json" {
+		t.Fatalf("unexpected applied entry: %+v", applied)
+	}
+
+	text := formatAuditEntries(entries, 0, 1)
+	if !strings.Contains(text, "@alice (1)") || !strings.Contains(text, "error: boom") {
+		t.Fatalf("unexpected formatted audit page: %s", text)
+	}
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/bonus2k/xray-tlg/internal/backup"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	maxHistoryButtons = 10
+	backupTimeLayout  = "2006-01-02 15:04:05 UTC"
+)
+
+func WithBackups(store *backup.Store) Option {
+	return func(h *Handler) {
+		h.backups = store
+	}
+}
+
+// replaceActiveConfig swaps sourcePath into xrayConfigPath. The current active
+// config is backed up only after every check has passed, right before the
+// rename, so rejected candidates do not churn the history.
+func (h *Handler) replaceActiveConfig(req callbackRequest, sourcePath, replacedBy string, checks ...func(tempPath string) error) error {
+	return copyConfigFile(sourcePath, h.xrayConfigPath, h.withBackupCheck(req, replacedBy, checks)...)
+}
+
+// installActiveConfig is replaceActiveConfig for content that is not a file
+// yet, such as a profile merged into the base template.
+func (h *Handler) installActiveConfig(req callbackRequest, data []byte, replacedBy string, checks ...func(tempPath string) error) error {
+	return installConfig(bytes.NewReader(data), h.xrayConfigPath, h.withBackupCheck(req, replacedBy, checks)...)
+}
+
+func (h *Handler) withBackupCheck(req callbackRequest, replacedBy string, checks []func(tempPath string) error) []func(tempPath string) error {
+	if h.backups == nil {
+		return checks
+	}
+	return append(checks[:len(checks):len(checks)], func(string) error {
+		return h.backupActiveConfig(req, replacedBy)
+	})
+}
+
+func (h *Handler) backupActiveConfig(req callbackRequest, replacedBy string) error {
+	entry, saved, err := h.backups.Save(h.xrayConfigPath, backup.Entry{
+		Source:     h.detectConfigSource(h.xrayConfigPath),
+		ReplacedBy: replacedBy,
+		UserID:     req.userID,
+		Username:   req.username,
+	})
+	if err != nil {
+		return fmt.Errorf("backup active config: %w", err)
+	}
+	if saved {
+		h.logger.Info("active config backed up", zap.String("backup_id", entry.ID), zap.String("source", entry.Source))
+		req.annotate("backup=" + entry.ID)
+	}
+	return nil
+}
+
+func (h *Handler) BackupsHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionRollback, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		return h.showBackups(ctx, b, req, "")
+	})
+}
+
+func (h *Handler) showBackups(ctx context.Context, b *bot.Bot, req callbackRequest, notice string) error {
+	var entries []backup.Entry
+	if h.backups != nil {
+		var err error
+		entries, err = h.backups.List()
+		if err != nil {
+			return err
+		}
+	}
+
+	text := notice + formatBackupHistory(entries)
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      req.chatID,
+		MessageID:   req.messageID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: h.backupsKeyboard(entries),
+	}); err != nil {
+		return fmt.Errorf("edit backups message: %w", err)
+	}
+	return nil
+}
+
+func (h *Handler) RollbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionRollback, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		entry, path, ok, err := h.lookupCallbackBackup(ctx, b, req)
+		if err != nil || !ok {
+			return err
+		}
+
+		if h.confirmationRequired(ConfirmActionRollback) {
+			return h.askConfirmation(ctx, b, req,
+				fmt.Sprintf("❓ Restore the config from %s?\nIt will replace <code>%s</code>.", html.EscapeString(describeBackup(entry)), html.EscapeString(h.xrayConfigPath)),
+				h.callbacks.encode(CallbackRollbackConfirm, entry.ID),
+				h.callbacks.encode(CallbackBackups),
+			)
+		}
+		return h.rollbackWithSecondFactor(ctx, b, req, entry, path)
+	})
+}
+
+func (h *Handler) ConfirmRollbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionRollback, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		if h.confirmationExpired(req) {
+			return h.sendConfirmationExpired(ctx, b, req)
+		}
+
+		entry, path, ok, err := h.lookupCallbackBackup(ctx, b, req)
+		if err != nil || !ok {
+			return err
+		}
+		return h.rollbackWithSecondFactor(ctx, b, req, entry, path)
+	})
+}
+
+func (h *Handler) rollbackWithSecondFactor(ctx context.Context, b *bot.Bot, req callbackRequest, entry backup.Entry, path string) error {
+	return h.runWithSecondFactor(ctx, b, req, actionRollback,
+		fmt.Sprintf("Restore the config from %s.", html.EscapeString(describeBackup(entry))),
+		func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+			return h.rollbackConfig(ctx, b, req, entry, path)
+		},
+	)
+}
+
+// rollbackConfig skips validation on purpose: the backup was live before,
+// and a rollback must work even when the validator itself is broken.
+func (h *Handler) rollbackConfig(ctx context.Context, b *bot.Bot, req callbackRequest, entry backup.Entry, path string) error {
+	h.logger.Info("rollback requested", zap.String("backup_id", entry.ID), zap.String("source", entry.Source))
+	req.annotate("restore=" + entry.ID)
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    req.chatID,
+		MessageID: req.messageID,
+		Text:      "⏪ Restoring the previous config...",
+	}); err != nil {
+		return fmt.Errorf("set rollback progress message: %w", err)
+	}
+
+	if err := h.replaceActiveConfig(req, path, "rollback "+entry.ID); err != nil {
+		return err
+	}
+	h.rememberActiveConfig(req, backupConfigName(entry))
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      req.chatID,
+		MessageID:   req.messageID,
+		Text:        fmt.Sprintf("✅ Restored the config from %s to <code>%s</code>.", html.EscapeString(describeBackup(entry)), html.EscapeString(h.xrayConfigPath)),
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: h.mainMenuKeyboard(req.role),
+	}); err != nil {
+		return fmt.Errorf("set rollback success message: %w", err)
+	}
+	return nil
+}
+
+func (h *Handler) lookupCallbackBackup(ctx context.Context, b *bot.Bot, req callbackRequest) (backup.Entry, string, bool, error) {
+	if len(req.args) != 1 {
+		return backup.Entry{}, "", false, fmt.Errorf("backup callback expects 1 argument, got %d", len(req.args))
+	}
+	if h.backups == nil {
+		return backup.Entry{}, "", false, errors.New("backups are disabled")
+	}
+
+	entry, path, err := h.backups.Get(req.args[0])
+	if errors.Is(err, backup.ErrNotFound) {
+		h.logger.Info("rollback requested for unknown backup", zap.String("backup_id", req.args[0]))
+		return backup.Entry{}, "", false, h.showBackups(ctx, b, req, "⚠️ This backup no longer exists.\n\n")
+	}
+	if err != nil {
+		return backup.Entry{}, "", false, err
+	}
+	return entry, path, true, nil
+}
+
+func (h *Handler) backupsKeyboard(entries []backup.Entry) *models.InlineKeyboardMarkup {
+	buttons := make([][]models.InlineKeyboardButton, 0, min(len(entries), maxHistoryButtons)+1)
+	for _, entry := range entries[:min(len(entries), maxHistoryButtons)] {
+		label := entry.Time.UTC().Format("01-02 15:04")
+		if entry.Source != "" {
+			label += " · " + shortenFileName(entry.Source)
+		}
+		buttons = append(buttons, []models.InlineKeyboardButton{{
+			Text:         "⏪ " + label,
+			CallbackData: h.callbacks.encode(CallbackRollback, entry.ID),
+		}})
+	}
+	buttons = append(buttons, []models.InlineKeyboardButton{{Text: "⬅️ Back to Main Menu", CallbackData: h.callbacks.encode(CallbackMainMenu)}})
+	return &models.InlineKeyboardMarkup{InlineKeyboard: buttons}
+}
+
+func formatBackupHistory(entries []backup.Entry) string {
+	if len(entries) == 0 {
+		return "⏪ No previous configs yet. A backup is taken every time a config is applied."
+	}
+
+	var builder strings.Builder
+	builder.WriteString("⏪ Previous active configs, newest first. Tap one to restore it:\n")
+	for i, entry := range entries[:min(len(entries), maxHistoryButtons)] {
+		fmt.Fprintf(&builder, "\n%d. %s", i+1, html.EscapeString(describeBackup(entry)))
+		if entry.ReplacedBy != "" {
+			fmt.Fprintf(&builder, ", replaced by <code>%s</code>", html.EscapeString(entry.ReplacedBy))
+		}
+		if by := describeUser(entry.UserID, entry.Username); by != "" {
+			fmt.Fprintf(&builder, " (%s)", html.EscapeString(by))
+		}
+	}
+	return builder.String()
+}
+
+// backupConfigName is the profile name a restored backup is shown under.
+func backupConfigName(entry backup.Entry) string {
+	if entry.Source != "" {
+		return entry.Source
+	}
+	return "backup " + entry.Time.UTC().Format(backupTimeLayout)
+}
+
+func describeBackup(entry backup.Entry) string {
+	text := entry.Time.UTC().Format(backupTimeLayout)
+	if entry.Source != "" {
+		text += " (" + entry.Source + ")"
+	}
+	return text
+}
+
+func describeUser(userID int64, username string) string {
+	switch {
+	case username != "":
+		return "@" + username
+	case userID != 0:
+		return fmt.Sprintf("user %d", userID)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bonus2k/xray-tlg/internal/backup"
+	"go.uber.org/zap"
+)
+
+func TestReplaceActiveConfigBacksUpPreviousConfig(t *testing.T) {
+	configsDir := t.TempDir()
+	activePath := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, filepath.Join(configsDir, "client-eu.json"), "eu")
+	writeTestFile(t, filepath.Join(configsDir, "client-us.json"), "us")
+	writeTestFile(t, activePath, "eu")
+
+	h := &Handler{
+		xrayConfigsDir: configsDir,
+		xrayConfigPath: activePath,
+		logger:         zap.NewNop(),
+		registry:       newConfigRegistry(configsDir),
+		backups:        backup.New(filepath.Join(t.TempDir(), "backups"), 5),
+	}
+	req := callbackRequest{userID: 7, username: "alice", audit: &auditNote{}}
+
+	if err := h.replaceActiveConfig(req, filepath.Join(configsDir, "client-us.json"), "client-us.json"); err != nil {
+		t.Fatalf("replaceActiveConfig returned error: %v", err)
+	}
+
+	entries, err := h.backups.List()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one backup, got %+v (%v)", entries, err)
+	}
+	entry := entries[0]
+	if entry.Source != "client-eu.json" || entry.ReplacedBy != "client-us.json" || entry.Username != "alice" {
+		t.Fatalf("unexpected backup entry: %+v", entry)
+	}
+	if len(req.audit.args) != 1 || req.audit.args[0] != "backup="+entry.ID {
+		t.Fatalf("backup id was not added to the audit entry: %v", req.audit.args)
+	}
+
+	text := formatBackupHistory(entries)
+	if !strings.Contains(text, "(client-eu.json), replaced by <code>client-us.json</code> (@alice)") {
+		t.Fatalf("unexpected history text: %s", text)
+	}
+
+	data, err := os.ReadFile(activePath)
+	if err != nil || string(data) != "us" {
+		t.Fatalf("active config was not replaced: %q (%v)", data, err)
+	}
+}
+
+func TestReplaceActiveConfigSkipsBackupWhenCheckFails(t *testing.T) {
+	dir := t.TempDir()
+	activePath := filepath.Join(dir, "config.json")
+	sourcePath := filepath.Join(dir, "broken.json")
+	writeTestFile(t, activePath, `{"inbounds": [], "outbounds": [{"protocol": "freedom"}]}`)
+	writeTestFile(t, sourcePath, `{`)
+
+	h := &Handler{
+		xrayConfigsDir: dir,
+		xrayConfigPath: activePath,
+		logger:         zap.NewNop(),
+		registry:       newConfigRegistry(dir),
+		backups:        backup.New(filepath.Join(dir, "backups"), 5),
+	}
+	if err := h.replaceActiveConfig(callbackRequest{}, sourcePath, "broken.json", validateConfigFile); err == nil {
+		t.Fatalf("expected validation error")
+	}
+
+	entries, err := h.backups.List()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("expected no backups, got %+v (%v)", entries, err)
+	}
+}
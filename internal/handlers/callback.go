@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CallbackMainMenu        = "main"
+	CallbackListConfigs     = "ls_config"
+	CallbackSpeedtest       = "speedtest"
+	CallbackCopyConfig      = "cp"
+	CallbackCopyConfirm     = "cp_ok"
+	CallbackRestart         = "restart"
+	CallbackRestartConfirm  = "restart_ok"
+	CallbackAuditPage       = "audit"
+	CallbackBackups         = "bk"
+	CallbackRollback        = "rb"
+	CallbackRollbackConfirm = "rb_ok"
+	CallbackDiff            = "diff"
+	CallbackUploadOverwrite = "up_ok"
+	CallbackUploadCancel    = "up_no"
+	CallbackExport          = "ex"
+	CallbackExportSend      = "ex_send"
+	CallbackManageConfigs   = "mg"
+	CallbackRenameConfig    = "mv"
+	CallbackDeleteConfig    = "del"
+	CallbackDeleteConfirm   = "del_ok"
+	CallbackSubscriptions   = "subs"
+)
+
+const (
+	callbackSeparator = ":"
+	// callbackSignatureSize is the number of HMAC bytes kept in callback data;
+	// 8 bytes is plenty against forgery and keeps the data short.
+	callbackSignatureSize = 8
+	callbackClockSkew     = time.Minute
+	defaultCallbackTTL    = 24 * time.Hour
+	callbackDataMaxLength = 64
+)
+
+var (
+	errCallbackTampered = errors.New("callback data signature mismatch")
+	errCallbackExpired  = errors.New("callback data expired")
+)
+
+func CallbackPrefix(name string) string {
+	return name + callbackSeparator
+}
+
+type callbackData struct {
+	name     string
+	args     []string
+	issuedAt time.Time
+}
+
+// callbackCodec signs callback data as <name>:<args...>:<issued>:<signature>
+// so that buttons cannot be forged and stop working after the TTL.
+type callbackCodec struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func newCallbackCodec(secret []byte, ttl time.Duration) *callbackCodec {
+	if ttl <= 0 {
+		ttl = defaultCallbackTTL
+	}
+	return &callbackCodec{secret: secret, ttl: ttl, now: time.Now}
+}
+
+func newRandomCallbackSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("generate callback secret: %w", err)
+	}
+	return secret, nil
+}
+
+func WithCallbackSigning(secret string, ttl time.Duration) Option {
+	return func(h *Handler) {
+		h.callbacks = newCallbackCodec([]byte(secret), ttl)
+	}
+}
+
+func (c *callbackCodec) encode(name string, args ...string) string {
+	parts := make([]string, 0, len(args)+2)
+	parts = append(parts, name)
+	parts = append(parts, args...)
+	parts = append(parts, strconv.FormatInt(c.now().Unix(), 36))
+
+	payload := strings.Join(parts, callbackSeparator)
+	return payload + callbackSeparator + c.sign(payload)
+}
+
+func (c *callbackCodec) decode(data string) (callbackData, error) {
+	separatorIndex := strings.LastIndex(data, callbackSeparator)
+	if separatorIndex < 0 {
+		return callbackData{}, fmt.Errorf("%w: missing signature", errCallbackTampered)
+	}
+
+	payload, signature := data[:separatorIndex], data[separatorIndex+1:]
+	if !hmac.Equal([]byte(signature), []byte(c.sign(payload))) {
+		return callbackData{}, errCallbackTampered
+	}
+
+	parts := strings.Split(payload, callbackSeparator)
+	if len(parts) < 2 {
+		return callbackData{}, fmt.Errorf("%w: malformed payload", errCallbackTampered)
+	}
+
+	issuedUnix, err := strconv.ParseInt(parts[len(parts)-1], 36, 64)
+	if err != nil {
+		return callbackData{}, fmt.Errorf("%w: malformed timestamp", errCallbackTampered)
+	}
+	issuedAt := time.Unix(issuedUnix, 0)
+
+	now := c.now()
+	if issuedAt.After(now.Add(callbackClockSkew)) {
+		return callbackData{}, fmt.Errorf("%w: issued in the future", errCallbackTampered)
+	}
+	if now.Sub(issuedAt) > c.ttl {
+		return callbackData{}, fmt.Errorf("%w: issued at %s", errCallbackExpired, issuedAt.UTC().Format(time.RFC3339))
+	}
+
+	return callbackData{
+		name:     parts[0],
+		args:     parts[1 : len(parts)-1],
+		issuedAt: issuedAt,
+	}, nil
+}
+
+func (c *callbackCodec) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:callbackSignatureSize])
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallbackCodecRoundTrip(t *testing.T) {
+	codec := newCallbackCodec([]byte("test-secret"), time.Hour)
+
+	encoded := codec.encode(CallbackCopyConfig, configID("client-eu.json"))
+	if len(encoded) > callbackDataMaxLength {
+		t.Fatalf("callback data too long: %d bytes", len(encoded))
+	}
+	if !strings.HasPrefix(encoded, CallbackPrefix(CallbackCopyConfig)) {
+		t.Fatalf("callback data does not match route prefix: %s", encoded)
+	}
+
+	data, err := codec.decode(encoded)
+	if err != nil {
+		t.Fatalf("decode returned error: %v", err)
+	}
+	if data.name != CallbackCopyConfig || len(data.args) != 1 {
+		t.Fatalf("unexpected decoded data: %+v", data)
+	}
+
+	data, err = codec.decode(codec.encode(CallbackMainMenu))
+	if err != nil || data.name != CallbackMainMenu || len(data.args) != 0 {
+		t.Fatalf("unexpected decoded data without args: %+v, err=%v", data, err)
+	}
+}
+
+func TestCallbackCodecRejectsTampering(t *testing.T) {
+	codec := newCallbackCodec([]byte("test-secret"), time.Hour)
+	encoded := codec.encode(CallbackCopyConfig, "AAAAAAAAAAAA")
+
+	forged := strings.Replace(encoded, "AAAAAAAAAAAA", "BBBBBBBBBBBB", 1)
+	if _, err := codec.decode(forged); !errors.Is(err, errCallbackTampered) {
+		t.Fatalf("expected tampered error, got: %v", err)
+	}
+
+	other := newCallbackCodec([]byte("other-secret"), time.Hour)
+	if _, err := other.decode(encoded); !errors.Is(err, errCallbackTampered) {
+		t.Fatalf("expected tampered error for another secret, got: %v", err)
+	}
+
+	for _, data := range []string{"", "restart", "cp_client-eu.json"} {
+		if _, err := codec.decode(data); !errors.Is(err, errCallbackTampered) {
+			t.Fatalf("expected tampered error for %q, got: %v", data, err)
+		}
+	}
+}
+
+func TestCallbackCodecRejectsExpired(t *testing.T) {
+	codec := newCallbackCodec([]byte("test-secret"), time.Hour)
+	issued := time.Now()
+	codec.now = func() time.Time { return issued }
+	encoded := codec.encode(CallbackRestart)
+
+	codec.now = func() time.Time { return issued.Add(2 * time.Hour) }
+	if _, err := codec.decode(encoded); !errors.Is(err, errCallbackExpired) {
+		t.Fatalf("expected expired error, got: %v", err)
+	}
+}
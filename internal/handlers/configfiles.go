@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var errConfigRejected = errors.New("config file rejected")
+
+// resolveConfigFile maps a file name coming from callback data to a path
+// inside xrayConfigsDir. Only regular files that are currently listed in the
+// directory are accepted; symlinks are followed only while they stay inside it.
+func (h *Handler) resolveConfigFile(fileName string) (string, error) {
+	if !isConfigName(fileName) {
+		return "", fmt.Errorf("%w: invalid file name %q", errConfigRejected, fileName)
+	}
+
+	fileNames, err := listConfigFileNames(h.xrayConfigsDir)
+	if err != nil {
+		return "", fmt.Errorf("read xray configs dir: %w", err)
+	}
+	if !slices.Contains(fileNames, fileName) {
+		return "", fmt.Errorf("%w: %q is not listed in configs dir", errConfigRejected, fileName)
+	}
+
+	configPath := filepath.Join(h.xrayConfigsDir, filepath.FromSlash(fileName))
+	info, err := os.Lstat(configPath)
+	if err != nil {
+		return "", fmt.Errorf("config file check failed: %w", err)
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		if err := checkSymlinkInsideDir(h.xrayConfigsDir, configPath); err != nil {
+			return "", err
+		}
+		if info, err = os.Stat(configPath); err != nil {
+			return "", fmt.Errorf("config file check failed: %w", err)
+		}
+	}
+
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%w: %q is not a regular file", errConfigRejected, fileName)
+	}
+
+	if activeInfo, err := os.Stat(h.xrayConfigPath); err == nil && os.SameFile(info, activeInfo) {
+		return "", fmt.Errorf("%w: %q is the active config itself", errConfigRejected, fileName)
+	}
+
+	return configPath, nil
+}
+
+// isConfigName accepts a plain file name, optionally inside non-hidden
+// subdirectories as listed by listConfigFileNames.
+func isConfigName(name string) bool {
+	parts := strings.Split(name, "/")
+	if len(parts) > maxGroupDepth+1 {
+		return false
+	}
+	for i, part := range parts {
+		if !isPlainFileName(part) {
+			return false
+		}
+		if i < len(parts)-1 && strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+func isPlainFileName(fileName string) bool {
+	if fileName == "" || fileName == "." || fileName == ".." {
+		return false
+	}
+	if strings.ContainsAny(fileName, "/\\\x00") {
+		return false
+	}
+	return filepath.Base(fileName) == fileName
+}
+
+func checkSymlinkInsideDir(dir, linkPath string) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("resolve configs dir: %w", err)
+	}
+	target, err := filepath.EvalSymlinks(linkPath)
+	if err != nil {
+		return fmt.Errorf("%w: broken symlink %q", errConfigRejected, filepath.Base(linkPath))
+	}
+
+	rel, err := filepath.Rel(realDir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return fmt.Errorf("%w: symlink %q points outside configs dir", errConfigRejected, filepath.Base(linkPath))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestResolveConfigFile(t *testing.T) {
+	configsDir := t.TempDir()
+	outsideDir := t.TempDir()
+
+	writeTestFile(t, filepath.Join(configsDir, "client-eu.json"), `{}`)
+	writeTestFile(t, filepath.Join(configsDir, "config.json"), `{}`)
+	writeTestFile(t, filepath.Join(outsideDir, "secret.json"), `{}`)
+	if err := os.Symlink(filepath.Join(outsideDir, "secret.json"), filepath.Join(configsDir, "escape.json")); err != nil {
+		t.Fatalf("create symlink failed: %v", err)
+	}
+	if err := os.Symlink("client-eu.json", filepath.Join(configsDir, "alias.json")); err != nil {
+		t.Fatalf("create symlink failed: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(configsDir, "nested"), 0o755); err != nil {
+		t.Fatalf("create dir failed: %v", err)
+	}
+	writeTestFile(t, filepath.Join(configsDir, "nested", "server.json"), `{}`)
+	if err := os.MkdirAll(filepath.Join(configsDir, ".trash"), 0o755); err != nil {
+		t.Fatalf("create dir failed: %v", err)
+	}
+	writeTestFile(t, filepath.Join(configsDir, ".trash", "old.json"), `{}`)
+
+	h := &Handler{
+		xrayConfigsDir: configsDir,
+		xrayConfigPath: filepath.Join(configsDir, "config.json"),
+		logger:         zap.NewNop(),
+	}
+
+	for _, name := range []string{"client-eu.json", "alias.json", "nested/server.json"} {
+		if _, err := h.resolveConfigFile(name); err != nil {
+			t.Fatalf("expected %s to resolve, got: %v", name, err)
+		}
+	}
+
+	rejected := []string{
+		"",
+		"..",
+		"../" + filepath.Base(outsideDir) + "/secret.json",
+		"../../etc/shadow",
+		"nested",
+		"nested/",
+		"nested/../client-eu.json",
+		".trash/old.json",
+		"missing.json",
+		"config.json",
+		"escape.json",
+	}
+	for _, name := range rejected {
+		if _, err := h.resolveConfigFile(name); !errors.Is(err, errConfigRejected) {
+			t.Fatalf("expected %q to be rejected, got: %v", name, err)
+		}
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s failed: %v", path, err)
+	}
+}
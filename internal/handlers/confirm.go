@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	ConfirmActionRestart  = "restart"
+	ConfirmActionApply    = "apply"
+	ConfirmActionRollback = "rollback"
+	ConfirmActionDelete   = "delete"
+
+	defaultConfirmTimeout = 60 * time.Second
+)
+
+func IsConfirmAction(name string) bool {
+	switch name {
+	case ConfirmActionRestart, ConfirmActionApply, ConfirmActionRollback, ConfirmActionDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func WithConfirmation(timeout time.Duration, skipActions []string) Option {
+	return func(h *Handler) {
+		if timeout > 0 {
+			h.confirmTimeout = timeout
+		}
+		h.skipConfirm = make(map[string]struct{}, len(skipActions))
+		for _, action := range skipActions {
+			h.skipConfirm[action] = struct{}{}
+		}
+	}
+}
+
+func (h *Handler) confirmationRequired(action string) bool {
+	_, skip := h.skipConfirm[action]
+	return !skip
+}
+
+// confirmationExpired is checked against the issue time of the Confirm
+// button itself, which is much shorter-lived than regular menu buttons.
+func (h *Handler) confirmationExpired(req callbackRequest) bool {
+	return time.Since(req.issuedAt) > h.confirmTimeout
+}
+
+func (h *Handler) askConfirmation(ctx context.Context, b *bot.Bot, req callbackRequest, question, confirmData, cancelData string) error {
+	req.markOutcome(audit.OutcomePending)
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    req.chatID,
+		MessageID: req.messageID,
+		Text:      fmt.Sprintf("%s\n\nAre you sure? Confirm within %s.", question, roundDurationToSeconds(h.confirmTimeout)),
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{{
+				{Text: "✅ Confirm", CallbackData: confirmData},
+				{Text: "❌ Cancel", CallbackData: cancelData},
+			}},
+		},
+	}); err != nil {
+		return fmt.Errorf("set confirmation message: %w", err)
+	}
+	return nil
+}
+
+func (h *Handler) sendConfirmationExpired(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+	req.markOutcome(audit.OutcomeExpired)
+	h.logger.Info("confirmation expired", zap.Int64("user_id", req.userID), zap.Time("issued_at", req.issuedAt))
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      req.chatID,
+		MessageID:   req.messageID,
+		Text:        "⌛ Confirmation expired, nothing was changed.",
+		ReplyMarkup: h.mainMenuKeyboard(req.role),
+	}); err != nil {
+		return fmt.Errorf("set confirmation expired message: %w", err)
+	}
+	return nil
+}
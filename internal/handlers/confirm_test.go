@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfirmationRequired(t *testing.T) {
+	h := &Handler{}
+	if !h.confirmationRequired(ConfirmActionRestart) || !h.confirmationRequired(ConfirmActionApply) {
+		t.Fatal("expected confirmation to be required by default")
+	}
+
+	WithConfirmation(0, []string{ConfirmActionApply})(h)
+	if h.confirmationRequired(ConfirmActionApply) {
+		t.Fatal("expected apply confirmation to be skipped")
+	}
+	if !h.confirmationRequired(ConfirmActionRestart) {
+		t.Fatal("expected restart confirmation to stay enabled")
+	}
+}
+
+func TestConfirmationExpired(t *testing.T) {
+	h := &Handler{confirmTimeout: time.Minute}
+
+	if h.confirmationExpired(callbackRequest{issuedAt: time.Now().Add(-30 * time.Second)}) {
+		t.Fatal("expected fresh confirmation to be valid")
+	}
+	if !h.confirmationExpired(callbackRequest{issuedAt: time.Now().Add(-2 * time.Minute)}) {
+		t.Fatal("expected old confirmation to be expired")
+	}
+}
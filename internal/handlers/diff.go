@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bonus2k/xray-tlg/internal/xrayconfig"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// telegramMessageLimit is the maximum length of a message text, counted
+	// after HTML entities are parsed.
+	telegramMessageLimit = 4096
+	maxDiffValueLength   = 80
+)
+
+func (h *Handler) DiffConfigHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionDiffConfig, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		entry, ok, err := h.lookupCallbackConfig(ctx, b, req)
+		if err != nil || !ok {
+			return err
+		}
+		req.annotate("file=" + entry.Name)
+
+		sourcePath, err := h.resolveConfigFile(entry.Name)
+		if errors.Is(err, errConfigRejected) {
+			h.logger.Named("security").Warn("config diff rejected",
+				zap.Error(err),
+				zap.Int64("user_id", req.userID),
+				zap.Int64("chat_id", req.chatID),
+			)
+			return h.sendDiffResult(ctx, b, req, entry, "⛔ This config cannot be compared.")
+		}
+		if err != nil {
+			return err
+		}
+
+		changes, err := h.diffConfigFiles(h.xrayConfigPath, sourcePath)
+		if err != nil {
+			return h.sendDiffResult(ctx, b, req, entry,
+				fmt.Sprintf("❌ Cannot compare <code>%s</code>: %s", html.EscapeString(entry.Name), html.EscapeString(err.Error())))
+		}
+
+		header := fmt.Sprintf("🔍 <code>%s</code> compared to <code>%s</code>:", html.EscapeString(entry.Name), html.EscapeString(h.xrayConfigPath))
+		if len(changes) == 0 {
+			return h.sendDiffResult(ctx, b, req, entry, header+"\n\nNo differences.")
+		}
+
+		lines := formatDiffLines(changes)
+		text := fmt.Sprintf("%s\n<pre>%s</pre>", header, html.EscapeString(lines))
+		if len([]rune(header))+len([]rune(lines))+1 <= telegramMessageLimit {
+			return h.sendDiffResult(ctx, b, req, entry, text)
+		}
+
+		if _, err := b.SendDocument(ctx, &bot.SendDocumentParams{
+			ChatID:         req.chatID,
+			Document:       &models.InputFileUpload{Filename: "diff-" + filepath.Base(entry.Name) + ".txt", Data: strings.NewReader(lines + "\n")},
+			Caption:        fmt.Sprintf("🔍 %d changes in <code>%s</code>", len(changes), html.EscapeString(entry.Name)),
+			ParseMode:      models.ParseModeHTML,
+			ProtectContent: true,
+		}); err != nil {
+			return fmt.Errorf("send diff document: %w", err)
+		}
+		return h.sendDiffResult(ctx, b, req, entry,
+			fmt.Sprintf("%s\n\n%d changes, sent as a file.", header, len(changes)))
+	})
+}
+
+func (h *Handler) sendDiffResult(ctx context.Context, b *bot.Bot, req callbackRequest, entry configEntry, text string) error {
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    req.chatID,
+		MessageID: req.messageID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "✅ Apply", CallbackData: h.makeCopyFileCallbackData(entry.ID)}},
+			{{Text: "⬅️ Back", CallbackData: h.configListCallback(groupOf(entry.Name))}},
+		}},
+	}); err != nil {
+		return fmt.Errorf("set diff message: %w", err)
+	}
+	return nil
+}
+
+// diffConfigFiles compares a candidate with the active config. A missing
+// active config counts as empty, so everything shows up as added.
+func (h *Handler) diffConfigFiles(activePath, candidatePath string) ([]xrayconfig.Change, error) {
+	active, err := os.ReadFile(activePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read active config: %w", err)
+	}
+	candidate, err := h.readProfile(candidatePath)
+	if err != nil {
+		return nil, err
+	}
+	return xrayconfig.Diff(active, candidate)
+}
+
+func formatDiffLines(changes []xrayconfig.Change) string {
+	lines := make([]string, 0, len(changes))
+	for _, change := range changes {
+		path := change.Path
+		if path == "" {
+			path = "(root)"
+		}
+		switch change.Kind {
+		case xrayconfig.ChangeAdded:
+			lines = append(lines, fmt.Sprintf("+ %s: %s", path, formatDiffValue(change.New)))
+		case xrayconfig.ChangeRemoved:
+			lines = append(lines, fmt.Sprintf("- %s: %s", path, formatDiffValue(change.Old)))
+		default:
+			lines = append(lines, fmt.Sprintf("~ %s: %s → %s", path, formatDiffValue(change.Old), formatDiffValue(change.New)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatDiffValue(value any) string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return truncateText(strings.TrimSpace(buffer.String()), maxDiffValueLength)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bonus2k/xray-tlg/internal/xrayconfig"
+)
+
+func TestFormatDiffLines(t *testing.T) {
+	got := formatDiffLines([]xrayconfig.Change{
+		{Path: "log.loglevel", Kind: xrayconfig.ChangeChanged, Old: "warning", New: "debug"},
+		{Path: "outbounds[block]", Kind: xrayconfig.ChangeAdded, New: map[string]any{"protocol": "blackhole"}},
+		{Path: "dns", Kind: xrayconfig.ChangeRemoved, Old: strings.Repeat("x", 200)},
+	})
+
+	lines := strings.Split(got, "\n")
+	if len(lines) != 3 {
+		t.Fatalf("formatDiffLines returned %d lines: %q", len(lines), got)
+	}
+	if lines[0] != `~ log.loglevel: "warning" → "debug"` {
+		t.Fatalf("changed line = %q", lines[0])
+	}
+	if lines[1] != `+ outbounds[block]: {"protocol":"blackhole"}` {
+		t.Fatalf("added line = %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "- dns: ") || len([]rune(lines[2])) > len("- dns: ")+maxDiffValueLength+1 {
+		t.Fatalf("removed line = %q", lines[2])
+	}
+}
+
+func TestDiffConfigFilesMissingActive(t *testing.T) {
+	dir := t.TempDir()
+	candidate := filepath.Join(dir, "a.json")
+	writeTestFile(t, candidate, `{"log": {"loglevel": "debug"}}`)
+
+	changes, err := (&Handler{}).diffConfigFiles(filepath.Join(dir, "config.json"), candidate)
+	if err != nil {
+		t.Fatalf("diffConfigFiles returned error: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("diffConfigFiles = %+v, want a single change", changes)
+	}
+}
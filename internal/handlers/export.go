@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bonus2k/xray-tlg/internal/xrayconfig"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// exportActiveID stands for xrayConfigPath in export callbacks; config IDs
+	// are always configIDLength characters long, so it cannot collide.
+	exportActiveID = "active"
+	exportFull     = "full"
+	exportRedacted = "redacted"
+)
+
+func (h *Handler) ExportConfigHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionExportConfig, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		name, _, ok, err := h.lookupExportTarget(ctx, b, req)
+		if err != nil || !ok {
+			return err
+		}
+
+		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:    req.chatID,
+			MessageID: req.messageID,
+			Text:      fmt.Sprintf("📤 Export <code>%s</code> as a file.\n\nThe redacted copy has UUIDs, passwords and private keys masked.", html.EscapeString(name)),
+			ParseMode: models.ParseModeHTML,
+			ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+				{
+					{Text: "📄 Full", CallbackData: h.callbacks.encode(CallbackExportSend, req.args[0], exportFull)},
+					{Text: "🙈 Redacted", CallbackData: h.callbacks.encode(CallbackExportSend, req.args[0], exportRedacted)},
+				},
+				{{Text: "⬅️ Back", CallbackData: h.configListCallback(groupOf(name))}},
+			}},
+		}); err != nil {
+			return fmt.Errorf("set export message: %w", err)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) SendExportHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionExportConfig, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		if len(req.args) != 2 || (req.args[1] != exportFull && req.args[1] != exportRedacted) {
+			return fmt.Errorf("export callback expects an id and a mode, got %v", req.args)
+		}
+		name, path, ok, err := h.lookupExportTarget(ctx, b, req)
+		if err != nil || !ok {
+			return err
+		}
+		redacted := req.args[1] == exportRedacted
+		req.annotate("file="+name, "mode="+req.args[1])
+		h.logger.Info("config export requested", zap.String("file", name), zap.Bool("redacted", redacted), zap.Int64("user_id", req.userID))
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read exported config: %w", err)
+		}
+		fileName := filepath.Base(name)
+		if redacted {
+			if data, err = xrayconfig.RedactJSON(data); err != nil {
+				return h.sendExportResult(ctx, b, req,
+					fmt.Sprintf("❌ Cannot redact <code>%s</code>: %s", html.EscapeString(name), html.EscapeString(err.Error())))
+			}
+			fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".redacted.json"
+		}
+
+		if _, err := b.SendDocument(ctx, &bot.SendDocumentParams{
+			ChatID:   req.chatID,
+			Document: &models.InputFileUpload{Filename: fileName, Data: bytes.NewReader(data)},
+		}); err != nil {
+			return fmt.Errorf("send exported config: %w", err)
+		}
+		return h.sendExportResult(ctx, b, req, fmt.Sprintf("📤 Sent <code>%s</code>.", html.EscapeString(fileName)))
+	})
+}
+
+// lookupExportTarget resolves the first callback argument to a profile in
+// xrayConfigsDir or to the active config.
+func (h *Handler) lookupExportTarget(ctx context.Context, b *bot.Bot, req callbackRequest) (string, string, bool, error) {
+	if len(req.args) == 0 {
+		return "", "", false, errors.New("export callback expects a config id")
+	}
+
+	if req.args[0] == exportActiveID {
+		if _, err := os.Stat(h.xrayConfigPath); err != nil {
+			return "", "", false, h.sendExportResult(ctx, b, req, "⚠️ There is no active config to export.")
+		}
+		return filepath.Base(h.xrayConfigPath), h.xrayConfigPath, true, nil
+	}
+
+	entryReq := req
+	entryReq.args = req.args[:1]
+	entry, ok, err := h.lookupCallbackConfig(ctx, b, entryReq)
+	if err != nil || !ok {
+		return "", "", false, err
+	}
+	path, err := h.resolveConfigFile(entry.Name)
+	if errors.Is(err, errConfigRejected) {
+		h.logger.Named("security").Warn("config export rejected",
+			zap.Error(err),
+			zap.Int64("user_id", req.userID),
+			zap.Int64("chat_id", req.chatID),
+		)
+		return "", "", false, h.sendExportResult(ctx, b, req, "⛔ This config cannot be exported.")
+	}
+	if err != nil {
+		return "", "", false, err
+	}
+	return entry.Name, path, true, nil
+}
+
+func (h *Handler) sendExportResult(ctx context.Context, b *bot.Bot, req callbackRequest, text string) error {
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    req.chatID,
+		MessageID: req.messageID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "⬅️ Back", CallbackData: h.callbacks.encode(CallbackListConfigs)}},
+		}},
+	}); err != nil {
+		return fmt.Errorf("set export message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigListKeyboardExportButtons(t *testing.T) {
+	h := &Handler{callbacks: newCallbackCodec([]byte("test-secret"), time.Hour)}
+	entries := []configEntry{{ID: configID("a.json"), Name: "a.json"}}
+	page := paginateConfigs(entries, "", 0, DefaultPageSize)
+
+	rows := h.buildConfigListKeyboard(page, "", RoleOperator).InlineKeyboard
+	if len(rows) != 3 || len(rows[1]) != 3 {
+		t.Fatalf("unexpected operator keyboard: %+v", rows)
+	}
+	data, err := h.callbacks.decode(rows[1][2].CallbackData)
+	if err != nil || data.name != CallbackExport || data.args[0] != entries[0].ID {
+		t.Fatalf("unexpected export button: %+v, err=%v", data, err)
+	}
+	data, err = h.callbacks.decode(rows[2][0].CallbackData)
+	if err != nil || data.name != CallbackExport || data.args[0] != exportActiveID {
+		t.Fatalf("unexpected export active button: %+v, err=%v", data, err)
+	}
+
+	if rows := h.buildConfigListKeyboard(page, "", RoleViewer).InlineKeyboard; len(rows) != 1 {
+		t.Fatalf("viewer should only get the back button, got %+v", rows)
+	}
+}
+
+func TestExportActiveIDCannotCollide(t *testing.T) {
+	if len(exportActiveID) == configIDLength {
+		t.Fatalf("exportActiveID must differ in length from config IDs")
+	}
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	DefaultPageSize = 10
+	// rootGroupID stands for xrayConfigsDir itself; it is shorter than any
+	// configID, so it never collides with a folder.
+	rootGroupID = "root"
+	// maxGroupDepth limits how many folder levels under xrayConfigsDir are
+	// listed.
+	maxGroupDepth = 4
+)
+
+// configPage is one page of a folder in the config list: its subfolders
+// first, then the configs directly inside it.
+type configPage struct {
+	group   string
+	groups  []string
+	entries []configEntry
+	page    int
+	pages   int
+}
+
+// WithPageSize sets how many folders and configs one page of the config
+// list shows. Zero or less uses DefaultPageSize.
+func WithPageSize(size int) Option {
+	return func(h *Handler) {
+		if size <= 0 {
+			size = DefaultPageSize
+		}
+		h.pageSize = size
+	}
+}
+
+// groupOf returns the folder of a config name, "" for xrayConfigsDir itself.
+func groupOf(name string) string {
+	if dir := path.Dir(name); dir != "." {
+		return dir
+	}
+	return ""
+}
+
+// groupID keeps folder paths of any length within the callback data limit.
+// The trailing slash keeps it apart from the ID of a file with the same name.
+func groupID(group string) string {
+	if group == "" {
+		return rootGroupID
+	}
+	return configID(group + "/")
+}
+
+// findGroup maps a callback group ID back to a folder that still holds configs.
+func findGroup(entries []configEntry, id string) (string, bool) {
+	if id == rootGroupID {
+		return "", true
+	}
+	for _, entry := range entries {
+		for group := groupOf(entry.Name); group != ""; group = groupOf(group) {
+			if groupID(group) == id {
+				return group, true
+			}
+		}
+	}
+	return "", false
+}
+
+// childGroups returns the folders directly inside group that hold configs at
+// any depth.
+func childGroups(entries []configEntry, group string) []string {
+	seen := make(map[string]struct{})
+	var groups []string
+	for _, entry := range entries {
+		rest := groupOf(entry.Name)
+		if group != "" {
+			var ok bool
+			if rest, ok = strings.CutPrefix(rest, group+"/"); !ok {
+				continue
+			}
+		}
+		if rest == "" {
+			continue
+		}
+		child, _, _ := strings.Cut(rest, "/")
+		child = path.Join(group, child)
+		if _, ok := seen[child]; !ok {
+			seen[child] = struct{}{}
+			groups = append(groups, child)
+		}
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// paginateConfigs returns the requested page of group, clamped to the pages
+// that exist.
+func paginateConfigs(entries []configEntry, group string, page, size int) configPage {
+	groups := childGroups(entries, group)
+	var files []configEntry
+	for _, entry := range entries {
+		if groupOf(entry.Name) == group {
+			files = append(files, entry)
+		}
+	}
+
+	total := len(groups) + len(files)
+	pages := max(1, (total+size-1)/size)
+	page = min(max(page, 0), pages-1)
+
+	result := configPage{group: group, page: page, pages: pages}
+	for i := page * size; i < min(total, (page+1)*size); i++ {
+		if i < len(groups) {
+			result.groups = append(result.groups, groups[i])
+		} else {
+			result.entries = append(result.entries, files[i-len(groups)])
+		}
+	}
+	return result
+}
+
+// entryPage returns the page of its folder that lists the config name, or the
+// first page when it is gone.
+func entryPage(entries []configEntry, name string, size int) int {
+	group := groupOf(name)
+	index := len(childGroups(entries, group))
+	for _, entry := range entries {
+		if groupOf(entry.Name) != group {
+			continue
+		}
+		if entry.Name == name {
+			return index / size
+		}
+		index++
+	}
+	return 0
+}
+
+// parseListArgs reads the folder and page from config list callback data.
+// Without arguments the list opens at the first page of the root folder.
+func parseListArgs(args []string) (string, int) {
+	id := rootGroupID
+	page := 0
+	if len(args) > 0 {
+		id = args[0]
+	}
+	if len(args) > 1 {
+		page, _ = strconv.Atoi(args[1])
+	}
+	return id, page
+}
+
+// configListCallback opens the config list at group.
+func (h *Handler) configListCallback(group string) string {
+	if group == "" {
+		return h.callbacks.encode(CallbackListConfigs)
+	}
+	return h.callbacks.encode(CallbackListConfigs, groupID(group))
+}
+
+func (h *Handler) configPageCallback(group string, page int) string {
+	return h.callbacks.encode(CallbackListConfigs, groupID(group), strconv.Itoa(page))
+}
+
+func (h *Handler) manageCallback(group string, page int) string {
+	return h.callbacks.encode(CallbackManageConfigs, groupID(group), strconv.Itoa(page))
+}
+
+// manageEntryCallback returns to the manage screen the config was picked on.
+func (h *Handler) manageEntryCallback(entry configEntry) string {
+	entries, err := h.registry.list()
+	if err != nil {
+		return h.manageCallback(groupOf(entry.Name), 0)
+	}
+	return h.manageCallback(groupOf(entry.Name), entryPage(entries, entry.Name, h.pageSize))
+}
+
+// navigationRows are the folder buttons of a page plus, when the folder has
+// more than one page, the ◀️ n/m ▶️ row.
+func (h *Handler) navigationRows(page configPage, active string) ([][]models.InlineKeyboardButton, []models.InlineKeyboardButton) {
+	folders := make([][]models.InlineKeyboardButton, 0, len(page.groups))
+	for _, group := range page.groups {
+		label := "📁 " + path.Base(group)
+		if strings.HasPrefix(active, group+"/") {
+			label = "📁 ✅ " + path.Base(group)
+		}
+		folders = append(folders, []models.InlineKeyboardButton{{Text: label, CallbackData: h.configListCallback(group)}})
+	}
+
+	if page.pages <= 1 {
+		return folders, nil
+	}
+	pager := make([]models.InlineKeyboardButton, 0, 3)
+	if page.page > 0 {
+		pager = append(pager, models.InlineKeyboardButton{Text: "◀️", CallbackData: h.configPageCallback(page.group, page.page-1)})
+	}
+	pager = append(pager, models.InlineKeyboardButton{
+		Text:         fmt.Sprintf("%d/%d", page.page+1, page.pages),
+		CallbackData: h.configPageCallback(page.group, page.page),
+	})
+	if page.page < page.pages-1 {
+		pager = append(pager, models.InlineKeyboardButton{Text: "▶️", CallbackData: h.configPageCallback(page.group, page.page+1)})
+	}
+	return folders, pager
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestListConfigFileNamesNested(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"de/provider", ".trash", "a/b/c/d/e"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatalf("mkdir failed: %v", err)
+		}
+	}
+	writeTestFile(t, filepath.Join(dir, "config.json"), `{}`)
+	writeTestFile(t, filepath.Join(dir, "top.json"), `{}`)
+	writeTestFile(t, filepath.Join(dir, ".config-123.json"), `{}`)
+	writeTestFile(t, filepath.Join(dir, "de", "config.json"), `{}`)
+	writeTestFile(t, filepath.Join(dir, "de", "provider", "fra.json"), `{}`)
+	writeTestFile(t, filepath.Join(dir, "de", "provider", "fra.meta"), `{}`)
+	writeTestFile(t, filepath.Join(dir, ".trash", "old.json"), `{}`)
+	writeTestFile(t, filepath.Join(dir, "a", "b", "c", "d", "e", "deep.json"), `{}`)
+
+	names, err := listConfigFileNames(dir)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	slices.Sort(names)
+	want := []string{"de/config.json", "de/provider/fra.json", "top.json"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("names = %q, want %q", names, want)
+	}
+	for _, name := range names {
+		if !isConfigName(name) {
+			t.Fatalf("listed name %q is not accepted", name)
+		}
+	}
+}
+
+func TestPaginateConfigs(t *testing.T) {
+	var entries []configEntry
+	for i := range 5 {
+		entries = append(entries, configEntry{Name: fmt.Sprintf("c%d.json", i)})
+	}
+	entries = append(entries,
+		configEntry{Name: "nl/a.json"},
+		configEntry{Name: "de/provider/b.json"},
+		configEntry{Name: "de/c.json"},
+	)
+
+	page := paginateConfigs(entries, "", 0, 3)
+	if page.pages != 3 || !slices.Equal(page.groups, []string{"de", "nl"}) || len(page.entries) != 1 || page.entries[0].Name != "c0.json" {
+		t.Fatalf("unexpected first page: %+v", page)
+	}
+	page = paginateConfigs(entries, "", 7, 3)
+	if page.page != 2 || len(page.groups) != 0 || len(page.entries) != 1 || page.entries[0].Name != "c4.json" {
+		t.Fatalf("expected the last page, got %+v", page)
+	}
+
+	if got := entryPage(entries, "c4.json", 3); got != 2 {
+		t.Fatalf("entryPage = %d, want 2", got)
+	}
+
+	page = paginateConfigs(entries, "de", 0, 3)
+	if page.pages != 1 || !slices.Equal(page.groups, []string{"de/provider"}) || len(page.entries) != 1 || page.entries[0].Name != "de/c.json" {
+		t.Fatalf("unexpected de page: %+v", page)
+	}
+
+	if group, ok := findGroup(entries, groupID("de/provider")); !ok || group != "de/provider" {
+		t.Fatalf("findGroup = %q, %v", group, ok)
+	}
+	if _, ok := findGroup(entries, groupID("us")); ok {
+		t.Fatal("expected an unknown folder not to be found")
+	}
+	if groupID("de") == configID("de") {
+		t.Fatal("folder IDs must differ from file IDs")
+	}
+}
+
+func TestConfigListKeyboardNavigation(t *testing.T) {
+	h := &Handler{callbacks: newCallbackCodec([]byte("test-secret"), time.Hour)}
+	entries := []configEntry{
+		{Name: "de/a.json"},
+		{Name: "de/b.json"},
+		{Name: "de/c.json"},
+		{Name: "de/nested/d.json"},
+	}
+
+	rows := h.buildConfigListKeyboard(paginateConfigs(entries, "de", 1, 2), "de/nested/d.json", RoleViewer).InlineKeyboard
+	if len(rows) != 2 || len(rows[0]) != 2 || rows[0][1].Text != "⬆️ Up" {
+		t.Fatalf("unexpected viewer keyboard: %+v", rows)
+	}
+	data, err := h.callbacks.decode(rows[0][1].CallbackData)
+	if err != nil || data.name != CallbackListConfigs || len(data.args) != 0 {
+		t.Fatalf("up should open the root, got %+v, err=%v", data, err)
+	}
+	if len(rows[1]) != 2 || rows[1][0].Text != "◀️" || rows[1][1].Text != "2/2" {
+		t.Fatalf("unexpected pagination row: %+v", rows[1])
+	}
+	data, err = h.callbacks.decode(rows[1][0].CallbackData)
+	if err != nil || !slices.Equal(data.args, []string{groupID("de"), "0"}) {
+		t.Fatalf("unexpected previous page button: %+v, err=%v", data, err)
+	}
+
+	rows = h.buildConfigListKeyboard(paginateConfigs(entries, "de", 0, 2), "de/nested/d.json", RoleViewer).InlineKeyboard
+	if rows[1][0].Text != "📁 ✅ nested" || rows[2][1].Text != "▶️" {
+		t.Fatalf("unexpected first page: %+v", rows)
+	}
+}
@@ -4,14 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"html"
 	"io"
+	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/bonus2k/xray-tlg/internal/backup"
+	"github.com/bonus2k/xray-tlg/internal/sharelink"
+	"github.com/bonus2k/xray-tlg/internal/subscription"
+	"github.com/bonus2k/xray-tlg/internal/xrayconfig"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"github.com/showwin/speedtest-go/speedtest"
@@ -32,8 +38,66 @@ type Handler struct {
 	busyUntil   time.Time
 	busyAction  string
 	lockTimeout time.Duration
+
+	allowedUserIDs map[int64]struct{}
+	allowedChatIDs map[int64]struct{}
+
+	roles       map[int64]Role
+	defaultRole Role
+
+	registry  *configRegistry
+	callbacks *callbackCodec
+
+	confirmTimeout time.Duration
+	skipConfirm    map[string]struct{}
+
+	totpSecrets  map[int64]string
+	inputMutex   sync.Mutex
+	inputs       map[int64]pendingInput
+	totpLastStep map[int64]int64
+
+	audit *audit.Log
+
+	rateLimiter *rateLimiter
+
+	validatorCommand []string
+	validatorTimeout time.Duration
+
+	backups *backup.Store
+
+	runCommand   commandRunner
+	restartGrace time.Duration
+	probeAddress string
+	servicePoll  time.Duration
+
+	statePath string
+
+	uploadMaxSize int64
+	uploads       map[int64]pendingUpload
+	httpClient    *http.Client
+
+	subscriptions *subscription.Manager
+	notifyChatIDs []int64
+
+	templatePath string
+
+	pageSize int
+}
+
+type callbackRequest struct {
+	chatID    int64
+	messageID int
+	userID    int64
+	username  string
+	role      Role
+	update    *models.Update
+	args      []string
+	issuedAt  time.Time
+	audit     *auditNote
 }
 
+type Option func(h *Handler)
+
 type commandBusyError struct {
 	action    string
 	remaining time.Duration
@@ -43,7 +107,7 @@ func (e commandBusyError) Error() string {
 	return fmt.Sprintf("action %q is busy for %s", e.action, e.remaining.Round(time.Second))
 }
 
-func NewHandler(xrayConfigsDir, xrayConfigPath, serviceName string, lockTimeout time.Duration, logger *zap.Logger) (*Handler, error) {
+func NewHandler(xrayConfigsDir, xrayConfigPath, serviceName string, lockTimeout time.Duration, logger *zap.Logger, opts ...Option) (*Handler, error) {
 	if logger == nil {
 		return nil, errors.New("logger is required")
 	}
@@ -66,37 +130,90 @@ func NewHandler(xrayConfigsDir, xrayConfigPath, serviceName string, lockTimeout
 		lockTimeout = defaultLockTimeout
 	}
 
-	return &Handler{
+	h := &Handler{
 		xrayConfigsDir: xrayConfigsDir,
 		xrayConfigPath: xrayConfigPath,
 		serviceName:    serviceName,
 		logger:         logger.Named("handler"),
 		lockTimeout:    lockTimeout,
-	}, nil
+		registry:       newConfigRegistry(xrayConfigsDir),
+		confirmTimeout: defaultConfirmTimeout,
+		runCommand:     runCommand,
+		restartGrace:   defaultRestartGrace,
+		servicePoll:    defaultServicePoll,
+		httpClient:     &http.Client{Timeout: defaultDownloadTimeout},
+		pageSize:       DefaultPageSize,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.callbacks == nil || len(h.callbacks.secret) == 0 {
+		secret, err := newRandomCallbackSecret()
+		if err != nil {
+			return nil, err
+		}
+		ttl := defaultCallbackTTL
+		if h.callbacks != nil {
+			ttl = h.callbacks.ttl
+		}
+		h.callbacks = newCallbackCodec(secret, ttl)
+		h.logger.Warn("callback secret is not configured, menus will stop working after a restart")
+	}
+
+	return h, nil
 }
 
-var mainMenuKeyboard = &models.InlineKeyboardMarkup{
-	InlineKeyboard: [][]models.InlineKeyboardButton{
-		{{Text: "📂 Select Config", CallbackData: "ls_config"}},
-		{{Text: "📶 Run Speedtest", CallbackData: "speedtest"}},
-		{{Text: "🔄 Restart Xray", CallbackData: "restart"}},
-	},
+func (h *Handler) mainMenuKeyboard(role Role) *models.InlineKeyboardMarkup {
+	buttons := make([][]models.InlineKeyboardButton, 0, 3)
+	if role.Can(actionListConfigs) {
+		buttons = append(buttons, []models.InlineKeyboardButton{{Text: "📂 Select Config", CallbackData: h.callbacks.encode(CallbackListConfigs)}})
+	}
+	if role.Can(actionSpeedtest) {
+		buttons = append(buttons, []models.InlineKeyboardButton{{Text: "📶 Run Speedtest", CallbackData: h.callbacks.encode(CallbackSpeedtest)}})
+	}
+	if role.Can(actionRollback) && h.backups != nil {
+		buttons = append(buttons, []models.InlineKeyboardButton{{Text: "⏪ Rollback", CallbackData: h.callbacks.encode(CallbackBackups)}})
+	}
+	if role.Can(actionRefreshSubscriptions) && h.subscriptions != nil {
+		buttons = append(buttons, []models.InlineKeyboardButton{{Text: "🔁 Refresh subscriptions", CallbackData: h.callbacks.encode(CallbackSubscriptions)}})
+	}
+	if role.Can(actionRestartService) {
+		buttons = append(buttons, []models.InlineKeyboardButton{{Text: "🔄 Restart Xray", CallbackData: h.callbacks.encode(CallbackRestart)}})
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: buttons}
 }
 
 func (h *Handler) ListConfigXrayHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	h.handleCallbackCommand(ctx, b, update, "list_configs", func(ctx context.Context, b *bot.Bot, chatID int64, messageID int, update *models.Update) error {
+	h.handleCallbackCommand(ctx, b, update, actionListConfigs, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
 		h.logger.Info("listing config files", zap.String("path", h.xrayConfigsDir))
 
-		dirEntries, err := os.ReadDir(h.xrayConfigsDir)
+		entries, err := h.registry.list()
 		if err != nil {
-			return fmt.Errorf("read xray configs dir: %w", err)
+			return err
+		}
+		active := h.activeConfig().name
+
+		id, number := parseListArgs(req.args)
+		group, found := findGroup(entries, id)
+		page := paginateConfigs(entries, group, number, h.pageSize)
+
+		text := "📂 Choose a config to activate.\n🔍 compares it with the active config, 📤 sends it as a file."
+		if !req.role.Can(actionCopyConfig) {
+			text = formatConfigListText(page.entries, active)
+		}
+		if group != "" {
+			text = "📁 " + group + "\n" + text
+		}
+		if !found {
+			text = "⚠️ This folder no longer exists.\n" + text
 		}
 
 		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
-			ChatID:      chatID,
-			MessageID:   messageID,
-			Text:        "📂 Choose a config to activate:",
-			ReplyMarkup: buildConfigListKeyboard(dirEntries),
+			ChatID:      req.chatID,
+			MessageID:   req.messageID,
+			Text:        text,
+			ReplyMarkup: h.buildConfigListKeyboard(page, active, req.role),
 		}); err != nil {
 			return fmt.Errorf("edit config list message: %w", err)
 		}
@@ -106,73 +223,212 @@ func (h *Handler) ListConfigXrayHandler(ctx context.Context, b *bot.Bot, update
 }
 
 func (h *Handler) RestartXrayHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	h.handleCallbackCommand(ctx, b, update, "restart_service", func(ctx context.Context, b *bot.Bot, chatID int64, messageID int, update *models.Update) error {
-		h.logger.Info("restart requested", zap.String("service", h.serviceName))
+	h.handleCallbackCommand(ctx, b, update, actionRestartService, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		if h.confirmationRequired(ConfirmActionRestart) {
+			return h.askConfirmation(ctx, b, req,
+				fmt.Sprintf("❓ Restart service <code>%s</code>?", html.EscapeString(h.serviceName)),
+				h.callbacks.encode(CallbackRestartConfirm),
+				h.callbacks.encode(CallbackMainMenu),
+			)
+		}
+		return h.restartXrayWithSecondFactor(ctx, b, req)
+	})
+}
 
-		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
-			ChatID:    chatID,
-			MessageID: messageID,
-			Text:      "🔄 Restarting the service, please wait...",
-		}); err != nil {
-			return fmt.Errorf("set restart progress message: %w", err)
+func (h *Handler) ConfirmRestartXrayHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionRestartService, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		if h.confirmationExpired(req) {
+			return h.sendConfirmationExpired(ctx, b, req)
 		}
+		return h.restartXrayWithSecondFactor(ctx, b, req)
+	})
+}
+
+func (h *Handler) restartXrayWithSecondFactor(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+	return h.runWithSecondFactor(ctx, b, req, actionRestartService,
+		fmt.Sprintf("Restart service <code>%s</code>.", html.EscapeString(h.serviceName)),
+		h.restartXray,
+	)
+}
+
+func (h *Handler) restartXray(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+	h.logger.Info("restart requested", zap.String("service", h.serviceName))
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    req.chatID,
+		MessageID: req.messageID,
+		Text:      "🔄 Restarting the service, please wait...",
+	}); err != nil {
+		return fmt.Errorf("set restart progress message: %w", err)
+	}
+
+	err := h.restartAndCheck(ctx)
+	var failure *serviceFailure
+	if errors.As(err, &failure) {
+		return h.recoverFailedRestart(ctx, b, req, failure)
+	}
+	if err != nil {
+		return err
+	}
+	h.markKnownGood(req)
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      req.chatID,
+		MessageID:   req.messageID,
+		Text:        fmt.Sprintf("✅ Service <code>%s</code> restarted successfully.", h.serviceName),
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: h.mainMenuKeyboard(req.role),
+	}); err != nil {
+		return fmt.Errorf("set restart success message: %w", err)
+	}
+
+	return nil
+}
 
-		if err := restartService(h.serviceName); err != nil {
+func (h *Handler) CopyConfigXrayHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionCopyConfig, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		entry, ok, err := h.lookupCallbackConfig(ctx, b, req)
+		if err != nil || !ok {
 			return err
 		}
 
-		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
-			ChatID:      chatID,
-			MessageID:   messageID,
-			Text:        fmt.Sprintf("✅ Service <code>%s</code> restarted successfully.", h.serviceName),
-			ParseMode:   models.ParseModeHTML,
-			ReplyMarkup: mainMenuKeyboard,
-		}); err != nil {
-			return fmt.Errorf("set restart success message: %w", err)
+		if h.confirmationRequired(ConfirmActionApply) {
+			return h.askConfirmation(ctx, b, req,
+				fmt.Sprintf("❓ Apply config %s?%s\nIt will replace <code>%s</code>.", describeConfig(entry), formatConfigDescription(entry), html.EscapeString(h.xrayConfigPath)),
+				h.callbacks.encode(CallbackCopyConfirm, entry.ID),
+				h.configListCallback(groupOf(entry.Name)),
+			)
+		}
+		return h.applyConfigWithSecondFactor(ctx, b, req, entry)
+	})
+}
+
+func (h *Handler) ConfirmCopyConfigXrayHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionCopyConfig, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		if h.confirmationExpired(req) {
+			return h.sendConfirmationExpired(ctx, b, req)
 		}
 
-		return nil
+		entry, ok, err := h.lookupCallbackConfig(ctx, b, req)
+		if err != nil || !ok {
+			return err
+		}
+		return h.applyConfigWithSecondFactor(ctx, b, req, entry)
 	})
 }
 
-func (h *Handler) CopyConfigXrayHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	h.handleCallbackCommand(ctx, b, update, "copy_config", func(ctx context.Context, b *bot.Bot, chatID int64, messageID int, update *models.Update) error {
-		fileName := strings.TrimPrefix(update.CallbackQuery.Data, "cp_")
-		h.logger.Info("copy config requested", zap.String("file", fileName))
+func (h *Handler) applyConfigWithSecondFactor(ctx context.Context, b *bot.Bot, req callbackRequest, entry configEntry) error {
+	return h.runWithSecondFactor(ctx, b, req, actionCopyConfig,
+		fmt.Sprintf("Apply config %s.", describeConfig(entry)),
+		func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+			return h.applyConfig(ctx, b, req, entry)
+		},
+	)
+}
+
+// lookupCallbackConfig resolves the config ID carried in the callback. When
+// the ID is unknown the user is asked to refresh the list and ok is false.
+func (h *Handler) lookupCallbackConfig(ctx context.Context, b *bot.Bot, req callbackRequest) (configEntry, bool, error) {
+	if len(req.args) != 1 {
+		return configEntry{}, false, fmt.Errorf("config callback expects 1 argument, got %d", len(req.args))
+	}
 
+	configID := req.args[0]
+	entry, err := h.registry.lookup(configID)
+	if errors.Is(err, errConfigOutdated) {
+		h.logger.Info("config requested for unknown id", zap.String("config_id", configID))
 		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
-			ChatID:    chatID,
-			MessageID: messageID,
-			Text:      "🛠 Applying the selected config...",
+			ChatID:      req.chatID,
+			MessageID:   req.messageID,
+			Text:        "⚠️ The config list is outdated, please refresh.",
+			ReplyMarkup: h.outdatedConfigListKeyboard(),
 		}); err != nil {
-			return fmt.Errorf("set copy progress message: %w", err)
+			return configEntry{}, false, fmt.Errorf("set outdated config list message: %w", err)
 		}
+		return configEntry{}, false, nil
+	}
+	if err != nil {
+		return configEntry{}, false, err
+	}
 
-		if err := copyConfigFile(filepath.Join(h.xrayConfigsDir, fileName), h.xrayConfigPath); err != nil {
-			return err
-		}
+	return entry, true, nil
+}
 
+func (h *Handler) applyConfig(ctx context.Context, b *bot.Bot, req callbackRequest, entry configEntry) error {
+	fileName := entry.Name
+	h.logger.Info("copy config requested", zap.String("file", fileName), zap.String("config_id", entry.ID))
+	req.annotate("file=" + fileName)
+
+	sourcePath, err := h.resolveConfigFile(fileName)
+	if errors.Is(err, errConfigRejected) {
+		h.logger.Named("security").Warn("config apply rejected",
+			zap.Error(err),
+			zap.Int64("user_id", req.userID),
+			zap.Int64("chat_id", req.chatID),
+			zap.String("data", req.update.CallbackQuery.Data),
+		)
 		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
-			ChatID:      chatID,
-			MessageID:   messageID,
-			Text:        fmt.Sprintf("✅ Config <code>%s</code> was applied to <code>%s</code>.", fileName, h.xrayConfigPath),
-			ParseMode:   models.ParseModeHTML,
-			ReplyMarkup: mainMenuKeyboard,
+			ChatID:      req.chatID,
+			MessageID:   req.messageID,
+			Text:        "⛔ This config cannot be applied.",
+			ReplyMarkup: h.mainMenuKeyboard(req.role),
 		}); err != nil {
-			return fmt.Errorf("set copy success message: %w", err)
+			return fmt.Errorf("set copy rejected message: %w", err)
 		}
-
 		return nil
-	})
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    req.chatID,
+		MessageID: req.messageID,
+		Text:      "🛠 Applying the selected config...",
+	}); err != nil {
+		return fmt.Errorf("set copy progress message: %w", err)
+	}
+
+	data, err := h.readProfile(sourcePath)
+	if err != nil {
+		return err
+	}
+	err = h.installActiveConfig(req, data, fileName, h.configChecks(ctx)...)
+	var invalid *xrayconfig.ValidationError
+	var rejected *validatorError
+	switch {
+	case errors.As(err, &invalid):
+		h.logger.Warn("config failed validation", zap.String("file", fileName), zap.Strings("problems", invalid.Problems))
+		return h.rejectInvalidConfig(ctx, b, req, formatValidationProblems(fileName, "applied", invalid.Problems))
+	case errors.As(err, &rejected):
+		h.logger.Warn("config rejected by validator", zap.String("file", fileName), zap.Error(err))
+		return h.rejectInvalidConfig(ctx, b, req, formatValidatorFailure(fileName, rejected))
+	case err != nil:
+		return err
+	}
+
+	h.rememberActiveConfig(req, fileName)
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      req.chatID,
+		MessageID:   req.messageID,
+		Text:        fmt.Sprintf("✅ Config %s was applied to <code>%s</code>.", describeConfig(entry), html.EscapeString(h.xrayConfigPath)),
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: h.mainMenuKeyboard(req.role),
+	}); err != nil {
+		return fmt.Errorf("set copy success message: %w", err)
+	}
+
+	return nil
 }
 
 func (h *Handler) SpeedtestHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	h.handleCallbackCommand(ctx, b, update, "speedtest", func(ctx context.Context, b *bot.Bot, chatID int64, messageID int, update *models.Update) error {
+	h.handleCallbackCommand(ctx, b, update, actionSpeedtest, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
 		h.logger.Info("speedtest requested")
 
 		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
-			ChatID:    chatID,
-			MessageID: messageID,
+			ChatID:    req.chatID,
+			MessageID: req.messageID,
 			Text:      "📶 Running speedtest. This can take up to 90 seconds...",
 		}); err != nil {
 			return fmt.Errorf("set speedtest progress message: %w", err)
@@ -184,11 +440,11 @@ func (h *Handler) SpeedtestHandler(ctx context.Context, b *bot.Bot, update *mode
 		}
 
 		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
-			ChatID:      chatID,
-			MessageID:   messageID,
+			ChatID:      req.chatID,
+			MessageID:   req.messageID,
 			Text:        formatSpeedTestMessage(result),
 			ParseMode:   models.ParseModeHTML,
-			ReplyMarkup: mainMenuKeyboard,
+			ReplyMarkup: h.mainMenuKeyboard(req.role),
 		}); err != nil {
 			return fmt.Errorf("set speedtest result message: %w", err)
 		}
@@ -198,36 +454,75 @@ func (h *Handler) SpeedtestHandler(ctx context.Context, b *bot.Bot, update *mode
 }
 
 func (h *Handler) DefaultHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	release, err := h.acquireCommandLock("main_menu")
-	if err != nil {
-		h.sendBusyMessage(ctx, b, update, err)
+	if update.CallbackQuery != nil {
+		// Callback data that matched no route is a menu from an older format.
+		h.rejectCallbackData(ctx, b, update.CallbackQuery, errCallbackExpired)
 		return
 	}
-	defer release()
 
-	chatID, ok := getMessageChatID(update)
-	if !ok {
+	sender, ok := getUpdateSender(update)
+	if !ok || update.Message == nil {
 		h.logger.Warn("default handler update missing message")
 		return
 	}
 
-	h.logger.Info("open main menu", zap.Int64("chat_id", chatID))
+	if update.Message.Document != nil {
+		h.UploadConfigHandler(ctx, b, update)
+		return
+	}
+
+	if input, ok := h.takeInput(sender.userID, sender.chatID); ok {
+		input.handle(ctx, b, update.Message)
+		return
+	}
+
+	if len(sharelink.Find(update.Message.Text)) > 0 {
+		h.ImportLinksHandler(ctx, b, update)
+		return
+	}
+
+	if isSearchQuery(update.Message.Text) {
+		h.SearchConfigsHandler(ctx, b, update)
+		return
+	}
+
+	started := time.Now()
+	req := callbackRequest{
+		chatID:   sender.chatID,
+		userID:   sender.userID,
+		username: sender.username,
+		role:     h.roleFor(sender.userID),
+		update:   update,
+	}
+
+	release, err := h.acquireCommandLock(actionMainMenu)
+	if err != nil {
+		h.recordCallbackAudit(req, actionMainMenu, audit.OutcomeBusy, err, started)
+		h.sendBusyMessage(ctx, b, update, err)
+		return
+	}
+	defer release()
+
+	h.logger.Info("open main menu", zap.Int64("chat_id", req.chatID), zap.Stringer("role", req.role))
 	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID:      chatID,
-		Text:        "👋 Choose an action:\n• apply config\n• check speed\n• restart Xray",
-		ReplyMarkup: mainMenuKeyboard,
+		ChatID:      req.chatID,
+		Text:        h.mainMenuText("👋 Choose an action:\n• apply config\n• check speed\n• restart Xray"),
+		ReplyMarkup: h.mainMenuKeyboard(req.role),
 	}); err != nil {
-		h.logger.Error("send main menu failed", zap.Error(err), zap.Int64("chat_id", chatID))
+		h.logger.Error("send main menu failed", zap.Error(err), zap.Int64("chat_id", req.chatID))
+		h.recordCallbackAudit(req, actionMainMenu, audit.OutcomeError, err, started)
+		return
 	}
+	h.recordCallbackAudit(req, actionMainMenu, audit.OutcomeOK, nil, started)
 }
 
 func (h *Handler) MainHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	h.handleCallbackCommand(ctx, b, update, "main_menu", func(ctx context.Context, b *bot.Bot, chatID int64, messageID int, update *models.Update) error {
+	h.handleCallbackCommand(ctx, b, update, actionMainMenu, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
 		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
-			ChatID:      chatID,
-			MessageID:   messageID,
-			Text:        "🏠 Main menu. Choose an action:",
-			ReplyMarkup: mainMenuKeyboard,
+			ChatID:      req.chatID,
+			MessageID:   req.messageID,
+			Text:        h.mainMenuText("🏠 Main menu. Choose an action:"),
+			ReplyMarkup: h.mainMenuKeyboard(req.role),
 		}); err != nil {
 			return fmt.Errorf("set main menu message: %w", err)
 		}
@@ -241,7 +536,7 @@ func (h *Handler) handleCallbackCommand(
 	b *bot.Bot,
 	update *models.Update,
 	action string,
-	run func(context.Context, *bot.Bot, int64, int, *models.Update) error,
+	run func(context.Context, *bot.Bot, callbackRequest) error,
 ) {
 	callback := update.CallbackQuery
 	if callback == nil ||
@@ -251,16 +546,51 @@ func (h *Handler) handleCallbackCommand(
 		return
 	}
 
+	started := time.Now()
+	req := callbackRequest{
+		chatID:    callback.Message.Message.Chat.ID,
+		messageID: callback.Message.Message.ID,
+		userID:    callback.From.ID,
+		username:  callback.From.Username,
+		role:      h.roleFor(callback.From.ID),
+		update:    update,
+		audit:     &auditNote{},
+	}
+	chatID := req.chatID
+
+	data, err := h.callbacks.decode(callback.Data)
+	if err != nil {
+		outcome := audit.OutcomeExpired
+		if errors.Is(err, errCallbackTampered) {
+			outcome = audit.OutcomeRejected
+		}
+		h.recordCallbackAudit(req, action, outcome, err, started)
+		h.rejectCallbackData(ctx, b, callback, err)
+		return
+	}
+	req.args = data.args
+	req.issuedAt = data.issuedAt
+
+	if !req.role.Can(action) {
+		h.logger.Warn("callback rejected by role",
+			zap.String("action", action),
+			zap.Int64("user_id", req.userID),
+			zap.Stringer("role", req.role),
+			zap.Int64("chat_id", chatID),
+		)
+		h.recordCallbackAudit(req, action, audit.OutcomeDenied, nil, started)
+		h.sendForbiddenAlert(ctx, b, callback.ID, req.role)
+		return
+	}
+
 	release, err := h.acquireCommandLock(action)
 	if err != nil {
+		h.recordCallbackAudit(req, action, audit.OutcomeBusy, err, started)
 		h.sendBusyMessage(ctx, b, update, err)
 		return
 	}
 	defer release()
 
-	chatID := callback.Message.Message.Chat.ID
-	messageID := callback.Message.Message.ID
-
 	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
 		CallbackQueryID: callback.ID,
 		ShowAlert:       false,
@@ -269,13 +599,26 @@ func (h *Handler) handleCallbackCommand(
 	}
 
 	h.logger.Info("handling callback", zap.String("action", action), zap.Int64("chat_id", chatID), zap.String("data", callback.Data))
-	if err := run(ctx, b, chatID, messageID, update); err != nil {
-		h.logger.Error("callback handler failed", zap.String("action", action), zap.Error(err), zap.Int64("chat_id", chatID))
-		h.sendHandlerError(ctx, b, chatID, messageID)
+	h.executeCommand(ctx, b, req, action, run)
+}
+
+func (h *Handler) executeCommand(
+	ctx context.Context,
+	b *bot.Bot,
+	req callbackRequest,
+	action string,
+	run func(context.Context, *bot.Bot, callbackRequest) error,
+) {
+	started := time.Now()
+	if err := run(ctx, b, req); err != nil {
+		h.logger.Error("callback handler failed", zap.String("action", action), zap.Error(err), zap.Int64("chat_id", req.chatID))
+		h.recordCallbackAudit(req, action, audit.OutcomeError, err, started)
+		h.sendHandlerError(ctx, b, req)
 		return
 	}
 
-	h.logger.Info("callback handled", zap.String("action", action), zap.Int64("chat_id", chatID))
+	h.recordCallbackAudit(req, action, audit.OutcomeOK, nil, started)
+	h.logger.Info("callback handled", zap.String("action", action), zap.Int64("chat_id", req.chatID))
 }
 
 func (h *Handler) acquireCommandLock(action string) (func(), error) {
@@ -333,52 +676,187 @@ func (h *Handler) sendBusyMessage(ctx context.Context, b *bot.Bot, update *model
 	}
 }
 
-func (h *Handler) sendHandlerError(ctx context.Context, b *bot.Bot, chatID int64, messageID int) {
+func (h *Handler) rejectCallbackData(ctx context.Context, b *bot.Bot, callback *models.CallbackQuery, err error) {
+	text := "⌛ This menu has expired. Send any message to open a new one."
+	if errors.Is(err, errCallbackTampered) {
+		h.logger.Named("security").Warn("callback data rejected",
+			zap.Error(err),
+			zap.Int64("user_id", callback.From.ID),
+			zap.String("data", callback.Data),
+		)
+		text = "⛔ This button is not valid."
+	} else {
+		h.logger.Info("stale callback rejected", zap.Error(err), zap.Int64("user_id", callback.From.ID), zap.String("data", callback.Data))
+	}
+
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: callback.ID,
+		ShowAlert:       true,
+		Text:            text,
+	}); err != nil {
+		h.logger.Warn("send callback rejection alert failed", zap.Error(err))
+	}
+}
+
+func (h *Handler) sendForbiddenAlert(ctx context.Context, b *bot.Bot, callbackID string, role Role) {
+	if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: callbackID,
+		ShowAlert:       true,
+		Text:            fmt.Sprintf("⛔ Your role (%s) does not allow this action.", role),
+	}); err != nil {
+		h.logger.Warn("send forbidden alert failed", zap.Error(err))
+	}
+}
+
+func (h *Handler) sendHandlerError(ctx context.Context, b *bot.Bot, req callbackRequest) {
 	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
-		ChatID:      chatID,
-		MessageID:   messageID,
+		ChatID:      req.chatID,
+		MessageID:   req.messageID,
 		Text:        "⚠️ Something went wrong. Please try again.",
-		ReplyMarkup: mainMenuKeyboard,
+		ReplyMarkup: h.mainMenuKeyboard(req.role),
 	}); err != nil {
-		h.logger.Error("failed to send user-facing error message", zap.Error(err), zap.Int64("chat_id", chatID))
+		h.logger.Error("failed to send user-facing error message", zap.Error(err), zap.Int64("chat_id", req.chatID))
+	}
+}
+
+func (h *Handler) buildConfigListKeyboard(page configPage, active string, role Role) *models.InlineKeyboardMarkup {
+	buttons := make([][]models.InlineKeyboardButton, 0, len(page.groups)+len(page.entries)+4)
+	top := []models.InlineKeyboardButton{{Text: "⬅️ Back to Main Menu", CallbackData: h.callbacks.encode(CallbackMainMenu)}}
+	if page.group != "" {
+		top = append(top, models.InlineKeyboardButton{Text: "⬆️ Up", CallbackData: h.configListCallback(groupOf(page.group))})
+	}
+	buttons = append(buttons, top)
+
+	folders, pager := h.navigationRows(page, active)
+	buttons = append(buttons, folders...)
+
+	if role.Can(actionCopyConfig) {
+		for _, entry := range page.entries {
+			buttons = append(buttons, h.configRow(entry, entry.buttonLabel(), active, role))
+		}
+	}
+
+	if pager != nil {
+		buttons = append(buttons, pager)
+	}
+	if !role.Can(actionCopyConfig) {
+		return &models.InlineKeyboardMarkup{InlineKeyboard: buttons}
+	}
+
+	if role.Can(actionExportConfig) {
+		buttons = append(buttons, []models.InlineKeyboardButton{{Text: "📤 Export active config", CallbackData: h.callbacks.encode(CallbackExport, exportActiveID)}})
+	}
+	if role.Can(actionManageConfigs) && len(page.entries) > 0 {
+		buttons = append(buttons, []models.InlineKeyboardButton{{Text: "⚙️ Rename or delete", CallbackData: h.manageCallback(page.group, page.page)}})
+	}
+
+	return &models.InlineKeyboardMarkup{InlineKeyboard: buttons}
+}
+
+// configRow is the apply button of a config followed by the 🔍 and 📤
+// buttons the role may use.
+func (h *Handler) configRow(entry configEntry, label, active string, role Role) []models.InlineKeyboardButton {
+	if entry.Name == active {
+		label = "✅ " + label
+	}
+	row := []models.InlineKeyboardButton{{
+		Text:         label,
+		CallbackData: h.makeCopyFileCallbackData(entry.ID),
+	}}
+	if role.Can(actionDiffConfig) {
+		row = append(row, models.InlineKeyboardButton{Text: "🔍", CallbackData: h.callbacks.encode(CallbackDiff, entry.ID)})
+	}
+	if role.Can(actionExportConfig) {
+		row = append(row, models.InlineKeyboardButton{Text: "📤", CallbackData: h.callbacks.encode(CallbackExport, entry.ID)})
+	}
+	return row
+}
+
+// listConfigFileNames returns the configs in dir and in its non-hidden
+// subdirectories up to maxGroupDepth levels deep, without metadata sidecars.
+// Names of nested files use "/" as the separator.
+func listConfigFileNames(dir string) ([]string, error) {
+	var fileNames []string
+	if err := collectConfigFileNames(dir, "", 0, &fileNames); err != nil {
+		return nil, err
 	}
+	return fileNames, nil
 }
 
-func buildConfigListKeyboard(entries []os.DirEntry) *models.InlineKeyboardMarkup {
-	buttons := make([][]models.InlineKeyboardButton, 0, len(entries)+1)
-	buttons = append(buttons, []models.InlineKeyboardButton{{Text: "⬅️ Back to Main Menu", CallbackData: "main"}})
+func collectConfigFileNames(dir, prefix string, depth int, fileNames *[]string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
 
 	for _, entry := range entries {
 		if entry.IsDir() {
+			if strings.HasPrefix(entry.Name(), ".") || depth >= maxGroupDepth {
+				continue
+			}
+			if err := collectConfigFileNames(filepath.Join(dir, entry.Name()), prefix+entry.Name()+"/", depth+1, fileNames); err != nil {
+				return err
+			}
 			continue
 		}
 
-		if entry.Name() == "config.json" {
+		// Hidden files are temp files of a config being written.
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if (prefix == "" && entry.Name() == "config.json") || strings.HasSuffix(entry.Name(), metaSuffix) {
 			continue
 		}
 
-		buttons = append(buttons, []models.InlineKeyboardButton{{
-			Text:         shortenFileName(entry.Name()),
-			CallbackData: makeCopyFileCallbackData(entry.Name()),
-		}})
+		*fileNames = append(*fileNames, prefix+entry.Name())
 	}
+	return nil
+}
 
-	return &models.InlineKeyboardMarkup{InlineKeyboard: buttons}
+func formatConfigListText(entries []configEntry, active string) string {
+	if len(entries) == 0 {
+		return "📂 No configs available."
+	}
+
+	var builder strings.Builder
+	builder.WriteString("📂 Available configs:")
+	for _, entry := range entries {
+		builder.WriteString("\n• ")
+		builder.WriteString(entry.title())
+		if entry.title() != entry.Name {
+			builder.WriteString(" (" + entry.Name + ")")
+		}
+		if entry.Name == active {
+			builder.WriteString(" ✅")
+		}
+	}
+	return builder.String()
+}
+
+func (h *Handler) outdatedConfigListKeyboard() *models.InlineKeyboardMarkup {
+	return &models.InlineKeyboardMarkup{
+		InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "🔄 Refresh", CallbackData: h.callbacks.encode(CallbackListConfigs)}},
+			{{Text: "⬅️ Back to Main Menu", CallbackData: h.callbacks.encode(CallbackMainMenu)}},
+		},
+	}
 }
 
 func shortenFileName(fileName string) string {
-	fileName = strings.TrimSpace(fileName)
-	if len(fileName) <= 24 {
-		return fileName
+	runes := []rune(strings.TrimSpace(fileName))
+	if len(runes) <= 24 {
+		return string(runes)
 	}
-	return fileName[:12] + "..." + fileName[len(fileName)-9:]
+	return string(runes[:12]) + "..." + string(runes[len(runes)-9:])
 }
 
-func makeCopyFileCallbackData(fileName string) string {
-	return "cp_" + fileName
+func (h *Handler) makeCopyFileCallbackData(configID string) string {
+	return h.callbacks.encode(CallbackCopyConfig, configID)
 }
 
-func copyConfigFile(sourcePath, destinationPath string) error {
+// copyConfigFile installs the file at sourcePath as destinationPath, see
+// installConfig.
+func copyConfigFile(sourcePath, destinationPath string, checks ...func(tempPath string) error) error {
 	sourceInfo, err := os.Stat(sourcePath)
 	if err != nil {
 		return fmt.Errorf("source file check failed: %w", err)
@@ -395,36 +873,55 @@ func copyConfigFile(sourcePath, destinationPath string) error {
 		_ = sourceFile.Close()
 	}()
 
-	tempPath := destinationPath + ".tmp"
-	destinationFile, err := os.Create(tempPath)
+	return installConfig(sourceFile, destinationPath, checks...)
+}
+
+// installConfig writes source into a temp file next to the destination, runs
+// the checks against it and only then renames it into place.
+// The temp file keeps the .json extension, because Xray picks its config
+// loader from the extension.
+func installConfig(source io.Reader, destinationPath string, checks ...func(tempPath string) error) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(destinationPath); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	destinationFile, err := os.CreateTemp(filepath.Dir(destinationPath), ".config-*.json")
 	if err != nil {
 		return fmt.Errorf("create destination temp file: %w", err)
 	}
+	tempPath := destinationFile.Name()
 
-	if _, err := io.Copy(destinationFile, sourceFile); err != nil {
+	if _, err := io.Copy(destinationFile, source); err != nil {
 		_ = destinationFile.Close()
+		_ = os.Remove(tempPath)
 		return fmt.Errorf("copy config file: %w", err)
 	}
-
+	if err := destinationFile.Chmod(mode); err != nil {
+		_ = destinationFile.Close()
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("chmod destination temp file: %w", err)
+	}
 	if err := destinationFile.Close(); err != nil {
+		_ = os.Remove(tempPath)
 		return fmt.Errorf("close destination temp file: %w", err)
 	}
 
+	for _, check := range checks {
+		if err := check(tempPath); err != nil {
+			_ = os.Remove(tempPath)
+			return err
+		}
+	}
+
 	if err := os.Rename(tempPath, destinationPath); err != nil {
+		_ = os.Remove(tempPath)
 		return fmt.Errorf("replace destination file: %w", err)
 	}
 
 	return nil
 }
 
-func restartService(serviceName string) error {
-	cmd := exec.Command("systemctl", "restart", serviceName)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to restart service %s: %w", serviceName, err)
-	}
-	return nil
-}
-
 type speedTestResult struct {
 	Host       string
 	ServerName string
@@ -498,6 +995,14 @@ func formatSpeedTestMessage(r speedTestResult) string {
 	)
 }
 
+func truncateText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return string(runes[:limit]) + "…"
+}
+
 func roundDurationToSeconds(duration time.Duration) time.Duration {
 	if duration < 0 {
 		return 0
@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/bonus2k/xray-tlg/internal/xrayconfig"
 )
 
 func TestCopyConfigFileFromTestdata(t *testing.T) {
@@ -35,3 +38,28 @@ func TestCopyConfigFileFromTestdata(t *testing.T) {
 		})
 	}
 }
+
+func TestCopyConfigFileKeepsDestinationWhenValidationFails(t *testing.T) {
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "broken.json")
+	destinationPath := filepath.Join(dir, "config.json")
+	writeTestFile(t, sourcePath, `{"inbounds": [`)
+	writeTestFile(t, destinationPath, `{"active": true}`)
+
+	err := copyConfigFile(sourcePath, destinationPath, validateConfigFile)
+	var invalid *xrayconfig.ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	data, err := os.ReadFile(destinationPath)
+	if err != nil {
+		t.Fatalf("read destination file failed: %v", err)
+	}
+	if string(data) != `{"active": true}` {
+		t.Fatalf("destination was overwritten: %s", data)
+	}
+	if _, err := os.Stat(destinationPath + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temp file was not removed: %v", err)
+	}
+}
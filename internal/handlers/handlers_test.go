@@ -3,6 +3,7 @@ package handlers
 import (
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"go.uber.org/zap"
 )
@@ -14,11 +15,22 @@ func TestShortenFileName(t *testing.T) {
 	if len(short) >= len(name) {
 		t.Fatalf("expected shortened name, got %q", short)
 	}
+
+	if short := shortenFileName("конфигурация-для-сервера-в-европе.json"); !utf8.ValidString(short) {
+		t.Fatalf("shortened name is not valid UTF-8: %q", short)
+	}
 }
 
 func TestMakeCopyFileCallbackData(t *testing.T) {
-	if got := makeCopyFileCallbackData("cfg.json"); got != "cp_cfg.json" {
-		t.Fatalf("unexpected callback data: %s", got)
+	h := &Handler{callbacks: newCallbackCodec([]byte("test-secret"), time.Hour)}
+	id := configID("cfg.json")
+
+	data, err := h.callbacks.decode(h.makeCopyFileCallbackData(id))
+	if err != nil {
+		t.Fatalf("decode returned error: %v", err)
+	}
+	if data.name != CallbackCopyConfig || len(data.args) != 1 || data.args[0] != id {
+		t.Fatalf("unexpected callback data: %+v", data)
 	}
 }
 
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/bonus2k/xray-tlg/internal/backup"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRestartGrace   = 10 * time.Second
+	defaultServicePoll    = time.Second
+	serviceLogLines       = 20
+	maxServiceLogLength   = 1500
+	autoRollbackReplacing = "auto-rollback"
+)
+
+type commandRunner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+func runCommand(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).CombinedOutput()
+}
+
+// serviceFailure means the service did not reach a healthy state after a
+// restart, as opposed to the bot failing to ask systemd at all.
+type serviceFailure struct {
+	reason string
+	logs   string
+}
+
+func (f *serviceFailure) Error() string {
+	return "service is not healthy: " + f.reason
+}
+
+// WithRestartCheck makes restarts wait up to grace for the service to stay
+// active and, when probeAddress is set, to accept TCP connections on it.
+// A zero grace only checks the exit code of systemctl.
+func WithRestartCheck(grace time.Duration, probeAddress string) Option {
+	return func(h *Handler) {
+		h.restartGrace = grace
+		h.probeAddress = probeAddress
+	}
+}
+
+func (h *Handler) restartAndCheck(ctx context.Context) error {
+	output, err := h.runCommand(ctx, "systemctl", "restart", h.serviceName)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &serviceFailure{
+			reason: fmt.Sprintf("systemctl restart failed: %v", err),
+			logs:   h.serviceLogs(ctx, output),
+		}
+	}
+	return h.waitForService(ctx)
+}
+
+// waitForService polls the unit state until the grace period ends. The unit
+// must never turn failed or inactive and must be active at the end, and the
+// probe address, if any, must have accepted a connection at least once.
+func (h *Handler) waitForService(ctx context.Context) error {
+	if h.restartGrace <= 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(h.restartGrace)
+	probed := h.probeAddress == ""
+	var probeErr error
+	for {
+		state := h.serviceState(ctx)
+		if state == "failed" || state == "inactive" {
+			return &serviceFailure{reason: "unit is " + state, logs: h.serviceLogs(ctx, nil)}
+		}
+		if !probed {
+			probeErr = probeTCP(ctx, h.probeAddress, h.servicePoll)
+			probed = probeErr == nil
+		}
+
+		if !time.Now().Before(deadline) {
+			if state != "active" {
+				return &serviceFailure{reason: "unit is " + state, logs: h.serviceLogs(ctx, nil)}
+			}
+			if !probed {
+				return &serviceFailure{
+					reason: fmt.Sprintf("%s is not accepting connections: %v", h.probeAddress, probeErr),
+					logs:   h.serviceLogs(ctx, nil),
+				}
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(h.servicePoll):
+		}
+	}
+}
+
+func (h *Handler) serviceState(ctx context.Context) string {
+	// is-active exits non-zero for every state but "active" and still prints
+	// the state, so the error is ignored unless nothing was printed.
+	output, err := h.runCommand(ctx, "systemctl", "is-active", h.serviceName)
+	state := strings.TrimSpace(string(output))
+	if state == "" && err != nil {
+		return "unknown"
+	}
+	return state
+}
+
+func (h *Handler) serviceLogs(ctx context.Context, prefix []byte) string {
+	logs := strings.TrimSpace(string(prefix))
+	output, err := h.runCommand(ctx, "journalctl", "-u", h.serviceName, "-n", fmt.Sprint(serviceLogLines), "--no-pager", "-o", "cat")
+	if err != nil {
+		h.logger.Warn("read service logs failed", zap.Error(err), zap.String("service", h.serviceName))
+		return logs
+	}
+	return strings.TrimSpace(logs + "\n" + strings.TrimSpace(string(output)))
+}
+
+func probeTCP(ctx context.Context, address string, timeout time.Duration) error {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// recoverFailedRestart restores the config the service last ran with,
+// restarts again and reports both attempts to the user.
+func (h *Handler) recoverFailedRestart(ctx context.Context, b *bot.Bot, req callbackRequest, failure *serviceFailure) error {
+	h.logger.Error("service unhealthy after restart", zap.String("service", h.serviceName), zap.String("reason", failure.reason))
+	req.markOutcome(audit.OutcomeError)
+	req.annotate("unhealthy=" + failure.reason)
+
+	text := fmt.Sprintf("❌ Service <code>%s</code> did not come up: %s.", html.EscapeString(h.serviceName), html.EscapeString(failure.reason))
+	text += formatServiceLogs(failure.logs)
+
+	entry, path, ok := h.autoRollbackConfig()
+	if !ok {
+		text += "\n\nNo earlier config was found, so nothing was restored. Please check the server."
+		return h.sendRestartReport(ctx, b, req, text)
+	}
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    req.chatID,
+		MessageID: req.messageID,
+		Text:      text + "\n\n⏪ Restoring the previous config and restarting...",
+		ParseMode: models.ParseModeHTML,
+	}); err != nil {
+		h.logger.Warn("set auto-rollback progress message failed", zap.Error(err), zap.Int64("chat_id", req.chatID))
+	}
+
+	h.logger.Warn("auto-rollback started", zap.String("backup_id", entry.ID), zap.String("source", entry.Source))
+	req.annotate("auto_rollback=" + entry.ID)
+	if err := h.replaceActiveConfig(req, path, autoRollbackReplacing+" "+entry.ID); err != nil {
+		text += fmt.Sprintf("\n\n❌ Restoring the config from %s failed: %s", html.EscapeString(describeBackup(entry)), html.EscapeString(err.Error()))
+		return h.sendRestartReport(ctx, b, req, text)
+	}
+	h.rememberActiveConfig(req, backupConfigName(entry))
+
+	err := h.restartAndCheck(ctx)
+	var again *serviceFailure
+	switch {
+	case errors.As(err, &again):
+		h.logger.Error("service unhealthy after auto-rollback", zap.String("service", h.serviceName), zap.String("reason", again.reason))
+		text += fmt.Sprintf("\n\n⏪ Restored the config from %s, but the service is still down: %s.", html.EscapeString(describeBackup(entry)), html.EscapeString(again.reason))
+		text += formatServiceLogs(again.logs)
+	case err != nil:
+		return err
+	default:
+		h.logger.Info("auto-rollback succeeded", zap.String("backup_id", entry.ID))
+		h.markKnownGood(req)
+		text += fmt.Sprintf("\n\n⏪ Restored the config from %s and restarted: ✅ the service is running.", html.EscapeString(describeBackup(entry)))
+	}
+	return h.sendRestartReport(ctx, b, req, text)
+}
+
+// markKnownGood records the active config after a restart passed the health
+// check, so an auto-rollback prefers a config that has run. Without a grace
+// period no check ran, so nothing is recorded.
+func (h *Handler) markKnownGood(req callbackRequest) {
+	if h.backups == nil || h.restartGrace <= 0 {
+		return
+	}
+	entry := backup.Entry{Source: h.activeConfig().name, UserID: req.userID, Username: req.username}
+	if err := h.backups.MarkKnownGood(h.xrayConfigPath, entry); err != nil {
+		h.logger.Warn("record known good config failed", zap.Error(err))
+	}
+}
+
+// autoRollbackConfig returns the config the service last passed a health check
+// with. Until a restart has passed one, as on a fresh install, it falls back
+// to the newest backup: the config that ran before the one that failed.
+// A candidate identical to the active config is never returned.
+func (h *Handler) autoRollbackConfig() (backup.Entry, string, bool) {
+	if h.backups == nil {
+		return backup.Entry{}, "", false
+	}
+	entry, path, err := h.backups.KnownGood()
+	if errors.Is(err, backup.ErrNotFound) {
+		entry, path, err = h.newestBackup()
+	}
+	if err != nil {
+		if !errors.Is(err, backup.ErrNotFound) {
+			h.logger.Warn("read rollback config failed", zap.Error(err))
+		}
+		return backup.Entry{}, "", false
+	}
+
+	activeSum, _ := fileSHA256(h.xrayConfigPath)
+	if sum, err := fileSHA256(path); err != nil || sum == activeSum {
+		return backup.Entry{}, "", false
+	}
+	return entry, path, true
+}
+
+func (h *Handler) newestBackup() (backup.Entry, string, error) {
+	entries, err := h.backups.List()
+	if err != nil {
+		return backup.Entry{}, "", err
+	}
+	if len(entries) == 0 {
+		return backup.Entry{}, "", backup.ErrNotFound
+	}
+	return h.backups.Get(entries[0].ID)
+}
+
+func (h *Handler) sendRestartReport(ctx context.Context, b *bot.Bot, req callbackRequest, text string) error {
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      req.chatID,
+		MessageID:   req.messageID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: h.mainMenuKeyboard(req.role),
+	}); err != nil {
+		return fmt.Errorf("set restart report message: %w", err)
+	}
+	return nil
+}
+
+func formatServiceLogs(logs string) string {
+	if logs == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n<pre>%s</pre>", html.EscapeString(tailText(logs, maxServiceLogLength)))
+}
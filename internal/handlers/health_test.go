@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/backup"
+	"go.uber.org/zap"
+)
+
+type fakeSystemd struct {
+	states []string
+	calls  []string
+}
+
+func (f *fakeSystemd) run(_ context.Context, name string, args ...string) ([]byte, error) {
+	f.calls = append(f.calls, name+" "+strings.Join(args, " "))
+	switch {
+	case name == "journalctl":
+		return []byte("xray: failed to parse config"), nil
+	case len(args) > 0 && args[0] == "is-active":
+		state := f.states[0]
+		if len(f.states) > 1 {
+			f.states = f.states[1:]
+		}
+		if state != "active" {
+			return []byte(state + "\n"), errors.New("exit status 3")
+		}
+		return []byte("active\n"), nil
+	default:
+		return nil, nil
+	}
+}
+
+func newHealthTestHandler(systemd *fakeSystemd) *Handler {
+	return &Handler{
+		serviceName:  "xray",
+		logger:       zap.NewNop(),
+		runCommand:   systemd.run,
+		restartGrace: 20 * time.Millisecond,
+		servicePoll:  5 * time.Millisecond,
+	}
+}
+
+func TestRestartAndCheckHealthy(t *testing.T) {
+	systemd := &fakeSystemd{states: []string{"active"}}
+	h := newHealthTestHandler(systemd)
+
+	if err := h.restartAndCheck(context.Background()); err != nil {
+		t.Fatalf("restartAndCheck returned error: %v", err)
+	}
+	if systemd.calls[0] != "systemctl restart xray" {
+		t.Fatalf("unexpected first command: %v", systemd.calls)
+	}
+}
+
+func TestRestartAndCheckDetectsFailedUnit(t *testing.T) {
+	systemd := &fakeSystemd{states: []string{"active", "failed"}}
+	h := newHealthTestHandler(systemd)
+
+	err := h.restartAndCheck(context.Background())
+	var failure *serviceFailure
+	if !errors.As(err, &failure) {
+		t.Fatalf("expected serviceFailure, got %v", err)
+	}
+	if failure.reason != "unit is failed" || failure.logs != "xray: failed to parse config" {
+		t.Fatalf("unexpected failure: %+v", failure)
+	}
+}
+
+func TestRestartAndCheckProbesPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	address := listener.Addr().String()
+
+	h := newHealthTestHandler(&fakeSystemd{states: []string{"active"}})
+	h.probeAddress = address
+	if err := h.restartAndCheck(context.Background()); err != nil {
+		t.Fatalf("restartAndCheck returned error: %v", err)
+	}
+
+	_ = listener.Close()
+	err = h.restartAndCheck(context.Background())
+	var failure *serviceFailure
+	if !errors.As(err, &failure) || !strings.Contains(failure.reason, "not accepting connections") {
+		t.Fatalf("expected probe failure, got %v", err)
+	}
+}
+
+func TestRollbackConfigPrefersHealthyConfigs(t *testing.T) {
+	dir := t.TempDir()
+	activePath := filepath.Join(dir, "config.json")
+	h := &Handler{
+		xrayConfigsDir: dir,
+		xrayConfigPath: activePath,
+		logger:         zap.NewNop(),
+		registry:       newConfigRegistry(dir),
+		backups:        backup.New(filepath.Join(dir, "backups"), 10),
+	}
+	rollback := func() string {
+		t.Helper()
+		_, path, ok := h.autoRollbackConfig()
+		if !ok {
+			return ""
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read rollback config: %v", err)
+		}
+		return string(data)
+	}
+	save := func(content string) {
+		t.Helper()
+		writeTestFile(t, activePath, content)
+		if _, _, err := h.backups.Save(activePath, backup.Entry{}); err != nil {
+			t.Fatalf("Save returned error: %v", err)
+		}
+	}
+
+	writeTestFile(t, activePath, "first")
+	if got := rollback(); got != "" {
+		t.Fatalf("expected nothing to restore without backups, got %q", got)
+	}
+
+	// Before any restart passed a check, the config replaced last is restored.
+	save("running")
+	writeTestFile(t, activePath, "broken")
+	if got := rollback(); got != "running" {
+		t.Fatalf("expected the newest backup, got %q", got)
+	}
+
+	// Without a grace period nothing was checked, so nothing is recorded.
+	h.markKnownGood(callbackRequest{userID: 1})
+	if _, _, err := h.backups.KnownGood(); !errors.Is(err, backup.ErrNotFound) {
+		t.Fatalf("expected no known good config without a health check, got: %v", err)
+	}
+
+	h.restartGrace = time.Second
+	writeTestFile(t, activePath, "healthy")
+	h.markKnownGood(callbackRequest{userID: 1})
+	if got := rollback(); got != "" {
+		t.Fatalf("the known good config is the active one and must not be restored over itself, got %q", got)
+	}
+
+	// Backups of configs that never passed a health check lose to it.
+	save("uploaded, never restarted")
+	writeTestFile(t, activePath, "broken")
+	if got := rollback(); got != "healthy" {
+		t.Fatalf("expected the known good config, got %q", got)
+	}
+}
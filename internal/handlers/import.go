@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/bonus2k/xray-tlg/internal/sharelink"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const maxImportLinks = 50
+
+type importResult struct {
+	name      string
+	label     string
+	duplicate bool
+	err       error
+}
+
+// ImportLinksHandler saves a config for every share link in a text message.
+func (h *Handler) ImportLinksHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	sender, ok := getUpdateSender(update)
+	if !ok || update.Message == nil {
+		return
+	}
+	links := sharelink.Find(update.Message.Text)
+
+	started := time.Now()
+	req := callbackRequest{
+		chatID:   sender.chatID,
+		userID:   sender.userID,
+		username: sender.username,
+		role:     h.roleFor(sender.userID),
+		update:   update,
+		args:     []string{fmt.Sprintf("links=%d", len(links))},
+	}
+
+	if !req.role.Can(actionImportLinks) {
+		h.logger.Warn("link import rejected by role", zap.Int64("user_id", req.userID), zap.Stringer("role", req.role))
+		h.recordCallbackAudit(req, actionImportLinks, audit.OutcomeDenied, nil, started)
+		h.sendText(ctx, b, req.chatID, fmt.Sprintf("⛔ Your role (%s) does not allow this action.", req.role))
+		return
+	}
+	if len(links) > maxImportLinks {
+		h.recordCallbackAudit(req, actionImportLinks, audit.OutcomeRejected, errors.New("too many links"), started)
+		h.sendText(ctx, b, req.chatID, fmt.Sprintf("📥 Send at most %d links at once.", maxImportLinks))
+		return
+	}
+
+	release, err := h.acquireCommandLock(actionImportLinks)
+	if err != nil {
+		h.recordCallbackAudit(req, actionImportLinks, audit.OutcomeBusy, err, started)
+		h.sendBusyMessage(ctx, b, update, err)
+		return
+	}
+	defer release()
+
+	results := make([]importResult, 0, len(links))
+	imported := 0
+	for i, raw := range links {
+		result := h.importLink(ctx, raw)
+		if result.err != nil {
+			h.logger.Warn("share link rejected", zap.Int("link", i+1), zap.Error(result.err))
+		} else if !result.duplicate {
+			imported++
+			req.args = append(req.args, "imported="+result.name)
+		}
+		results = append(results, result)
+	}
+	h.logger.Info("share links imported", zap.Int("links", len(links)), zap.Int("imported", imported), zap.Int64("user_id", req.userID))
+
+	outcome := audit.OutcomeOK
+	if imported == 0 {
+		outcome = audit.OutcomeRejected
+	}
+	h.recordCallbackAudit(req, actionImportLinks, outcome, nil, started)
+
+	// The links carry credentials, so they do not stay in the chat once
+	// every one of them is safely stored.
+	text := formatImportResults(results)
+	if countImportFailures(results) == 0 {
+		h.deleteMessage(ctx, b, req.chatID, update.Message.ID)
+		text += "\n\nThe message with the links was deleted."
+	}
+	h.sendHTML(ctx, b, req.chatID, text, h.mainMenuKeyboard(req.role))
+}
+
+// importLink renders, checks and stores one link. A link whose config is
+// already stored under its name is reported as a duplicate.
+func (h *Handler) importLink(ctx context.Context, raw string) importResult {
+	link, err := sharelink.Parse(raw)
+	if err != nil {
+		return importResult{err: err}
+	}
+	result := importResult{label: link.Name}
+	if result.label == "" {
+		result.label = fmt.Sprintf("%s %s:%d", link.Protocol, link.Address, link.Port)
+	}
+
+	data, err := sharelink.Render(sharelink.DefaultTemplate, link)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	if _, err := h.validateUpload(ctx, result.label, data); err != nil {
+		result.err = err
+		return result
+	}
+
+	name, duplicate, err := availableConfigName(h.xrayConfigsDir, sharelink.FileName(link), data)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	result.name, result.duplicate = name, duplicate
+	if duplicate {
+		return result
+	}
+	result.err = writeConfigFile(h.xrayConfigsDir, name, data)
+	return result
+}
+
+// availableConfigName returns name, or name with a numeric suffix when it
+// is taken by a different config. duplicate is set when a file with the same
+// content already exists under one of those names.
+func availableConfigName(dir, name string, data []byte) (string, bool, error) {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	for i := 1; i < 100; i++ {
+		candidate := name
+		if i > 1 {
+			candidate = fmt.Sprintf("%s-%d.json", base, i)
+		}
+		if _, err := normalizeConfigName(candidate); err != nil {
+			continue
+		}
+
+		existing, err := os.ReadFile(filepath.Join(dir, candidate))
+		if errors.Is(err, os.ErrNotExist) {
+			if _, err := os.Lstat(filepath.Join(dir, candidate)); errors.Is(err, os.ErrNotExist) {
+				return candidate, false, nil
+			}
+			continue
+		}
+		if err == nil && bytes.Equal(existing, data) {
+			return candidate, true, nil
+		}
+	}
+	return "", false, fmt.Errorf("no free file name for %s", name)
+}
+
+func formatImportResults(results []importResult) string {
+	var saved, duplicates, failed strings.Builder
+	savedCount, duplicateCount := 0, 0
+	for i, result := range results {
+		switch {
+		case result.err != nil:
+			fmt.Fprintf(&failed, "\n• link %d: %s", i+1, html.EscapeString(truncateText(result.err.Error(), 200)))
+		case result.duplicate:
+			duplicateCount++
+			fmt.Fprintf(&duplicates, "\n• <code>%s</code>", html.EscapeString(result.name))
+		default:
+			savedCount++
+			fmt.Fprintf(&saved, "\n• <code>%s</code> (%s)", html.EscapeString(result.name), html.EscapeString(result.label))
+		}
+	}
+
+	text := fmt.Sprintf("📥 Imported %d of %d links.", savedCount, len(results))
+	if savedCount > 0 {
+		text += "\n" + saved.String()
+	}
+	if duplicateCount > 0 {
+		text += "\n\nAlready saved:" + duplicates.String()
+	}
+	if failed.Len() > 0 {
+		text += "\n\n⚠️ Skipped:" + failed.String()
+	}
+	return text
+}
+
+func countImportFailures(results []importResult) int {
+	failures := 0
+	for _, result := range results {
+		if result.err != nil {
+			failures++
+		}
+	}
+	return failures
+}
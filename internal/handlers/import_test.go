@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImportLink(t *testing.T) {
+	dir := t.TempDir()
+	h := &Handler{xrayConfigsDir: dir, xrayConfigPath: filepath.Join(dir, "config.json")}
+	link := "trojan://secret@tr.example.com:443?sni=tr.example.com#Trojan%20EU"
+
+	first := h.importLink(context.Background(), link)
+	if first.err != nil || first.duplicate || first.name != "Trojan-EU.json" {
+		t.Fatalf("unexpected first import: %+v", first)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, first.name))
+	if err != nil || !strings.Contains(string(data), `"remarks": "Trojan EU"`) {
+		t.Fatalf("unexpected stored config: %s, %v", data, err)
+	}
+
+	again := h.importLink(context.Background(), link)
+	if again.err != nil || !again.duplicate || again.name != first.name {
+		t.Fatalf("expected a duplicate, got %+v", again)
+	}
+
+	changed := h.importLink(context.Background(), "trojan://other@tr.example.com:443#Trojan%20EU")
+	if changed.err != nil || changed.duplicate || changed.name != "Trojan-EU-2.json" {
+		t.Fatalf("expected a suffixed name, got %+v", changed)
+	}
+
+	if bad := h.importLink(context.Background(), "vless://id@example.com:443?security=reality"); bad.err == nil {
+		t.Fatalf("expected an error for a reality link without a key, got %+v", bad)
+	}
+}
+
+func TestAvailableConfigNameSkipsReserved(t *testing.T) {
+	name, duplicate, err := availableConfigName(t.TempDir(), "config.json", []byte("{}"))
+	if err != nil || duplicate || name != "config-2.json" {
+		t.Fatalf("availableConfigName = %q, %v, %v", name, duplicate, err)
+	}
+}
+
+func TestFormatImportResults(t *testing.T) {
+	text := formatImportResults([]importResult{
+		{name: "a.json", label: "A"},
+		{name: "b.json", duplicate: true},
+		{err: os.ErrInvalid},
+	})
+	for _, want := range []string{"Imported 1 of 3 links", "<code>a.json</code> (A)", "Already saved:\n• <code>b.json</code>", "link 3: invalid argument"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("import summary misses %q:\n%s", want, text)
+		}
+	}
+}
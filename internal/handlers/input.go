@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const defaultInputTimeout = 2 * time.Minute
+
+// pendingInput is a free-text answer the bot is waiting for from one user,
+// e.g. a TOTP code. The next message of that user in the same chat is passed
+// to handle instead of opening the main menu.
+type pendingInput struct {
+	chatID    int64
+	expiresAt time.Time
+	handle    func(ctx context.Context, b *bot.Bot, message *models.Message)
+}
+
+func (h *Handler) awaitInput(userID, chatID int64, handle func(ctx context.Context, b *bot.Bot, message *models.Message)) {
+	h.inputMutex.Lock()
+	defer h.inputMutex.Unlock()
+
+	if h.inputs == nil {
+		h.inputs = make(map[int64]pendingInput)
+	}
+	h.inputs[userID] = pendingInput{
+		chatID:    chatID,
+		expiresAt: time.Now().Add(defaultInputTimeout),
+		handle:    handle,
+	}
+}
+
+func (h *Handler) takeInput(userID, chatID int64) (pendingInput, bool) {
+	h.inputMutex.Lock()
+	defer h.inputMutex.Unlock()
+
+	input, ok := h.inputs[userID]
+	if !ok || input.chatID != chatID {
+		return pendingInput{}, false
+	}
+	delete(h.inputs, userID)
+
+	if time.Now().After(input.expiresAt) {
+		return pendingInput{}, false
+	}
+	return input, true
+}
+
+func (h *Handler) cancelInput(userID int64) {
+	h.inputMutex.Lock()
+	defer h.inputMutex.Unlock()
+
+	delete(h.inputs, userID)
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// trashDirName is the subdirectory of xrayConfigsDir deleted configs are
+	// moved to. Directories are never listed as configs.
+	trashDirName    = ".trash"
+	trashTimeLayout = "20060102T150405Z"
+)
+
+func (h *Handler) ManageConfigsHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionManageConfigs, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		// Cancel on the rename prompt lands here.
+		h.cancelInput(req.userID)
+
+		entries, err := h.registry.list()
+		if err != nil {
+			return err
+		}
+		id, number := parseListArgs(req.args)
+		group, _ := findGroup(entries, id)
+		return h.showManagePage(ctx, b, req, entries, group, number, "")
+	})
+}
+
+// showManageConfigs shows the manage screen for the page of the folder that
+// lists name.
+func (h *Handler) showManageConfigs(ctx context.Context, b *bot.Bot, req callbackRequest, name, notice string) error {
+	entries, err := h.registry.list()
+	if err != nil {
+		return err
+	}
+	return h.showManagePage(ctx, b, req, entries, groupOf(name), entryPage(entries, name, h.pageSize), notice)
+}
+
+// showManagePage lists the configs of one page of the config list, so the
+// manage screen matches the page it was opened from.
+func (h *Handler) showManagePage(ctx context.Context, b *bot.Bot, req callbackRequest, entries []configEntry, group string, number int, notice string) error {
+	page := paginateConfigs(entries, group, number, h.pageSize)
+
+	text := notice + "⚙️ Tap a config to rename it, or 🗑 to move it to the trash."
+	if len(page.entries) == 0 {
+		text = notice + "⚙️ No configs to manage."
+	}
+	if group != "" {
+		text = fmt.Sprintf("📁 <code>%s</code>\n%s", html.EscapeString(group), text)
+	}
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      req.chatID,
+		MessageID:   req.messageID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: h.manageConfigsKeyboard(page, h.activeConfig().name),
+	}); err != nil {
+		return fmt.Errorf("set manage configs message: %w", err)
+	}
+	return nil
+}
+
+func (h *Handler) manageConfigsKeyboard(page configPage, active string) *models.InlineKeyboardMarkup {
+	buttons := make([][]models.InlineKeyboardButton, 0, len(page.entries)+1)
+	for _, entry := range page.entries {
+		row := []models.InlineKeyboardButton{{
+			Text:         "✏️ " + entry.buttonLabel(),
+			CallbackData: h.callbacks.encode(CallbackRenameConfig, entry.ID),
+		}}
+		if entry.Name != active {
+			row = append(row, models.InlineKeyboardButton{Text: "🗑", CallbackData: h.callbacks.encode(CallbackDeleteConfig, entry.ID)})
+		}
+		buttons = append(buttons, row)
+	}
+	buttons = append(buttons, []models.InlineKeyboardButton{{Text: "⬅️ Back", CallbackData: h.configPageCallback(page.group, page.page)}})
+	return &models.InlineKeyboardMarkup{InlineKeyboard: buttons}
+}
+
+func (h *Handler) DeleteConfigHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionManageConfigs, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		entry, path, ok, err := h.lookupManagedConfig(ctx, b, req, true)
+		if err != nil || !ok {
+			return err
+		}
+
+		if h.confirmationRequired(ConfirmActionDelete) {
+			return h.askConfirmation(ctx, b, req,
+				fmt.Sprintf("❓ Delete config %s?\nIt will be moved to <code>%s</code>.", describeConfig(entry), html.EscapeString(filepath.Join(h.xrayConfigsDir, trashDirName))),
+				h.callbacks.encode(CallbackDeleteConfirm, entry.ID),
+				h.manageEntryCallback(entry),
+			)
+		}
+		return h.deleteConfigWithSecondFactor(ctx, b, req, entry, path)
+	})
+}
+
+func (h *Handler) ConfirmDeleteConfigHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionManageConfigs, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		if h.confirmationExpired(req) {
+			return h.sendConfirmationExpired(ctx, b, req)
+		}
+
+		entry, path, ok, err := h.lookupManagedConfig(ctx, b, req, true)
+		if err != nil || !ok {
+			return err
+		}
+		return h.deleteConfigWithSecondFactor(ctx, b, req, entry, path)
+	})
+}
+
+func (h *Handler) deleteConfigWithSecondFactor(ctx context.Context, b *bot.Bot, req callbackRequest, entry configEntry, path string) error {
+	return h.runWithSecondFactor(ctx, b, req, actionManageConfigs,
+		fmt.Sprintf("Delete config %s.", describeConfig(entry)),
+		func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+			// The active config may have changed while the user confirmed.
+			if h.isActiveConfig(entry.Name, path) {
+				return h.showManageConfigs(ctx, b, req, entry.Name, activeConfigNotice(entry.Name))
+			}
+
+			trashPath, err := moveToTrash(h.xrayConfigsDir, entry.Name, time.Now())
+			if err != nil {
+				return err
+			}
+			h.logger.Info("config moved to trash", zap.String("file", entry.Name), zap.String("trash_path", trashPath))
+			req.annotate("delete="+entry.Name, "trash="+filepath.Base(trashPath))
+			return h.showManageConfigs(ctx, b, req, entry.Name, fmt.Sprintf("🗑 Moved <code>%s</code> to the trash.\n\n", html.EscapeString(entry.Name)))
+		},
+	)
+}
+
+func (h *Handler) RenameConfigHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionManageConfigs, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		entry, _, ok, err := h.lookupManagedConfig(ctx, b, req, false)
+		if err != nil || !ok {
+			return err
+		}
+		req.markOutcome(audit.OutcomePending)
+		return h.askRenameName(ctx, b, req, entry, "")
+	})
+}
+
+// askRenameName waits for the new name of a config. Invalid or taken names
+// are asked for again.
+func (h *Handler) askRenameName(ctx context.Context, b *bot.Bot, req callbackRequest, entry configEntry, notice string) error {
+	h.awaitInput(req.userID, req.chatID, func(ctx context.Context, b *bot.Bot, message *models.Message) {
+		started := time.Now()
+		req.audit = &auditNote{}
+
+		name, err := normalizeConfigName(message.Text)
+		if err == nil && path.Dir(entry.Name) != "." {
+			name = path.Join(path.Dir(entry.Name), name)
+		}
+		if err == nil && name == entry.Name {
+			err = errors.New("the name did not change")
+		}
+		if err == nil {
+			if _, statErr := os.Lstat(filepath.Join(h.xrayConfigsDir, filepath.FromSlash(name))); statErr == nil {
+				err = fmt.Errorf("%s already exists", name)
+			}
+		}
+		if err != nil {
+			if err := h.askRenameName(ctx, b, req, entry, fmt.Sprintf("⚠️ %s.\n\n", html.EscapeString(err.Error()))); err != nil {
+				h.logger.Warn("ask for config name failed", zap.Error(err), zap.Int64("chat_id", req.chatID))
+			}
+			return
+		}
+
+		release, err := h.acquireCommandLock(actionManageConfigs)
+		if err != nil {
+			h.recordCallbackAudit(req, actionManageConfigs, audit.OutcomeBusy, err, started)
+			h.sendBusyMessage(ctx, b, &models.Update{Message: message}, err)
+			return
+		}
+		defer release()
+
+		h.executeCommand(ctx, b, req, actionManageConfigs, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+			return h.renameConfig(ctx, b, req, entry, name)
+		})
+	})
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    req.chatID,
+		MessageID: req.messageID,
+		Text:      fmt.Sprintf("%s✏️ Send a new name for <code>%s</code> within %s.", notice, html.EscapeString(entry.Name), roundDurationToSeconds(defaultInputTimeout)),
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "❌ Cancel", CallbackData: h.manageEntryCallback(entry)}},
+		}},
+	}); err != nil {
+		h.cancelInput(req.userID)
+		return fmt.Errorf("set rename prompt message: %w", err)
+	}
+	return nil
+}
+
+func (h *Handler) renameConfig(ctx context.Context, b *bot.Bot, req callbackRequest, entry configEntry, name string) error {
+	if _, err := h.resolveConfigFile(entry.Name); err != nil {
+		return err
+	}
+	oldPath := filepath.Join(h.xrayConfigsDir, filepath.FromSlash(entry.Name))
+	newPath := filepath.Join(h.xrayConfigsDir, filepath.FromSlash(name))
+	err := renameNoReplace(oldPath, newPath)
+	if errors.Is(err, os.ErrExist) {
+		// The name was free when it was typed, but a subscription refresh
+		// or another admin may have taken it since.
+		req.markOutcome(audit.OutcomeRejected)
+		return h.showManageConfigs(ctx, b, req, entry.Name,
+			fmt.Sprintf("⚠️ <code>%s</code> already exists, the config was not renamed.\n\n", html.EscapeString(name)))
+	}
+	if err != nil {
+		return err
+	}
+	if err := moveConfigMeta(oldPath, newPath); err != nil {
+		h.logger.Warn("rename config metadata failed", zap.Error(err), zap.String("file", entry.Name))
+	}
+	h.renameActiveState(entry.Name, name)
+	h.logger.Info("config renamed", zap.String("file", entry.Name), zap.String("new_name", name))
+	req.annotate("rename="+entry.Name, "to="+name)
+
+	return h.showManageConfigs(ctx, b, req, name,
+		fmt.Sprintf("✏️ Renamed <code>%s</code> to <code>%s</code>.\n\n", html.EscapeString(entry.Name), html.EscapeString(name)))
+}
+
+// renameNoReplace moves oldPath to newPath, failing with os.ErrExist instead
+// of replacing a file that already has the new name.
+func renameNoReplace(oldPath, newPath string) error {
+	if err := os.Link(oldPath, newPath); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return err
+		}
+		return fmt.Errorf("rename config: %w", err)
+	}
+	if err := os.Remove(oldPath); err != nil {
+		_ = os.Remove(newPath)
+		return fmt.Errorf("rename config: %w", err)
+	}
+	return nil
+}
+
+// renameActiveState keeps the remembered active profile name in sync when
+// its source file is renamed.
+func (h *Handler) renameActiveState(oldName, newName string) {
+	state, err := readActiveState(h.statePath)
+	if err != nil || state.Name != oldName {
+		return
+	}
+	state.Name = newName
+	if err := writeActiveState(h.statePath, state); err != nil {
+		h.logger.Warn("save active config state failed", zap.Error(err), zap.String("path", h.statePath))
+	}
+}
+
+// lookupManagedConfig resolves the config in the callback. Deleting is
+// refused for the active config.
+func (h *Handler) lookupManagedConfig(ctx context.Context, b *bot.Bot, req callbackRequest, forDelete bool) (configEntry, string, bool, error) {
+	entry, ok, err := h.lookupCallbackConfig(ctx, b, req)
+	if err != nil || !ok {
+		return configEntry{}, "", false, err
+	}
+
+	path, err := h.resolveConfigFile(entry.Name)
+	if errors.Is(err, errConfigRejected) {
+		h.logger.Named("security").Warn("config management rejected",
+			zap.Error(err),
+			zap.Int64("user_id", req.userID),
+			zap.Int64("chat_id", req.chatID),
+		)
+		return configEntry{}, "", false, h.showManageConfigs(ctx, b, req, entry.Name, "⛔ This config cannot be changed.\n\n")
+	}
+	if err != nil {
+		return configEntry{}, "", false, err
+	}
+
+	if forDelete && h.isActiveConfig(entry.Name, path) {
+		req.markOutcome(audit.OutcomeRejected)
+		return configEntry{}, "", false, h.showManageConfigs(ctx, b, req, entry.Name, activeConfigNotice(entry.Name))
+	}
+	return entry, path, true, nil
+}
+
+func (h *Handler) isActiveConfig(name, path string) bool {
+	return h.activeConfig().name == name || h.isActiveConfigPath(path)
+}
+
+func activeConfigNotice(name string) string {
+	return fmt.Sprintf("⛔ <code>%s</code> is the active config and cannot be deleted.\n\n", html.EscapeString(name))
+}
+
+// moveToTrash moves a config into the trash subdirectory under a
+// timestamped name, so deleting the same name twice keeps both copies.
+// Configs from subdirectories keep the directory in the trashed name, and a
+// metadata sidecar follows its config.
+func moveToTrash(dir, name string, now time.Time) (string, error) {
+	trashDir := filepath.Join(dir, trashDirName)
+	if err := os.MkdirAll(trashDir, 0o750); err != nil {
+		return "", fmt.Errorf("create trash dir: %w", err)
+	}
+
+	flatName := strings.ReplaceAll(name, "/", "_")
+	trashPath := filepath.Join(trashDir, now.UTC().Format(trashTimeLayout)+"-"+flatName)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(trashPath); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		trashPath = filepath.Join(trashDir, fmt.Sprintf("%s-%d-%s", now.UTC().Format(trashTimeLayout), i, flatName))
+	}
+
+	configPath := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.Rename(configPath, trashPath); err != nil {
+		return "", fmt.Errorf("move config to trash: %w", err)
+	}
+	if err := moveConfigMeta(configPath, trashPath); err != nil {
+		return trashPath, err
+	}
+	return trashPath, nil
+}
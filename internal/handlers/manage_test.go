@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestMoveToTrash(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	writeTestFile(t, filepath.Join(dir, "a.json"), "first")
+	first, err := moveToTrash(dir, "a.json", now)
+	if err != nil {
+		t.Fatalf("moveToTrash returned error: %v", err)
+	}
+	writeTestFile(t, filepath.Join(dir, "a.json"), "second")
+	second, err := moveToTrash(dir, "a.json", now)
+	if err != nil {
+		t.Fatalf("moveToTrash returned error: %v", err)
+	}
+
+	if first == second {
+		t.Fatalf("second delete overwrote the first: %s", first)
+	}
+	if filepath.Dir(first) != filepath.Join(dir, trashDirName) || filepath.Base(first) != "20261016T120000Z-a.json" {
+		t.Fatalf("unexpected trash path: %s", first)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.json")); !os.IsNotExist(err) {
+		t.Fatalf("config is still in place: %v", err)
+	}
+	if data, err := os.ReadFile(second); err != nil || string(data) != "second" {
+		t.Fatalf("trash copy = %q, %v", data, err)
+	}
+
+	entries, err := newConfigRegistry(dir).list()
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("trash must not be listed as configs, got %v, %v", entries, err)
+	}
+}
+
+func TestManageConfigsKeyboardKeepsActive(t *testing.T) {
+	h := &Handler{callbacks: newCallbackCodec([]byte("test-secret"), time.Hour)}
+	entries := []configEntry{
+		{ID: configID("a.json"), Name: "a.json"},
+		{ID: configID("b.json"), Name: "b.json"},
+	}
+
+	rows := h.manageConfigsKeyboard(paginateConfigs(entries, "", 0, DefaultPageSize), "a.json").InlineKeyboard
+	if len(rows[0]) != 1 {
+		t.Fatalf("active config must not have a delete button: %+v", rows[0])
+	}
+	data, err := h.callbacks.decode(rows[1][1].CallbackData)
+	if err != nil || data.name != CallbackDeleteConfig || data.args[0] != entries[1].ID {
+		t.Fatalf("unexpected delete button: %+v, err=%v", data, err)
+	}
+}
+
+func TestRenameActiveState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	h := &Handler{statePath: statePath, logger: zap.NewNop()}
+	if err := writeActiveState(statePath, activeState{Name: "a.json", SHA256: "abc"}); err != nil {
+		t.Fatalf("writeActiveState returned error: %v", err)
+	}
+
+	h.renameActiveState("other.json", "c.json")
+	h.renameActiveState("a.json", "b.json")
+
+	state, err := readActiveState(statePath)
+	if err != nil || state.Name != "b.json" || state.SHA256 != "abc" {
+		t.Fatalf("unexpected state: %+v, %v", state, err)
+	}
+}
+
+func TestRenameNoReplace(t *testing.T) {
+	dir := t.TempDir()
+	oldPath, newPath := filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")
+	writeTestFile(t, oldPath, "a")
+	writeTestFile(t, newPath, "taken")
+
+	if err := renameNoReplace(oldPath, newPath); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("expected os.ErrExist, got %v", err)
+	}
+	for path, want := range map[string]string{oldPath: "a", newPath: "taken"} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != want {
+			t.Fatalf("%s = %q, %v, want %q", path, data, err, want)
+		}
+	}
+
+	if err := os.Remove(newPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := renameNoReplace(oldPath, newPath); err != nil {
+		t.Fatalf("renameNoReplace returned error: %v", err)
+	}
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Fatalf("old name is still in place: %v", err)
+	}
+	if data, err := os.ReadFile(newPath); err != nil || string(data) != "a" {
+		t.Fatalf("renamed config = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// metaSuffix marks the optional sidecar of a profile: client-eu.meta
+	// describes client-eu.json. Sidecars are not listed as profiles.
+	metaSuffix = ".meta"
+	// maxButtonLabelLength keeps labels readable next to the 🔍 and 📤
+	// buttons on a phone screen.
+	maxButtonLabelLength = 32
+	// maxProfileReadSize is the largest file the Bot API lets a bot
+	// download, so no uploaded profile is larger.
+	maxProfileReadSize = 20 << 20
+)
+
+// configMeta is how a profile is presented in menus. It comes from the
+// sidecar, with the label falling back to the "remarks" field of the config.
+type configMeta struct {
+	Label       string `json:"label"`
+	Emoji       string `json:"emoji"`
+	Description string `json:"description"`
+	// Order puts profiles first, lowest first; profiles without it follow
+	// sorted by name.
+	Order int `json:"order"`
+}
+
+func metaPath(configPath string) string {
+	return strings.TrimSuffix(configPath, ".json") + metaSuffix
+}
+
+// readConfigMeta never fails: a missing or broken sidecar or config only
+// means the profile is shown under its file name. config is the content of
+// the profile, read by the caller.
+func readConfigMeta(configPath string, config []byte) configMeta {
+	var meta configMeta
+	if data, err := os.ReadFile(metaPath(configPath)); err == nil {
+		if err := json.Unmarshal(data, &meta); err != nil {
+			meta = configMeta{}
+		}
+	}
+	meta.Label = strings.TrimSpace(meta.Label)
+	if meta.Label == "" {
+		meta.Label = readRemarks(config)
+	}
+	return meta
+}
+
+func readRemarks(config []byte) string {
+	var fields struct {
+		Remarks string `json:"remarks"`
+	}
+	if err := json.Unmarshal(config, &fields); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(fields.Remarks)
+}
+
+// readProfileData reads a profile for its metadata. Larger files than the
+// bot could ever have downloaded are not read and shown under their name.
+func readProfileData(configPath string) []byte {
+	file, err := os.Open(configPath)
+	if err != nil {
+		return nil
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	data, err := io.ReadAll(io.LimitReader(file, maxProfileReadSize+1))
+	if err != nil || len(data) > maxProfileReadSize {
+		return nil
+	}
+	return data
+}
+
+// moveConfigMeta moves the sidecar of a profile along with it.
+func moveConfigMeta(oldConfigPath, newConfigPath string) error {
+	err := os.Rename(metaPath(oldConfigPath), metaPath(newConfigPath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("move config metadata: %w", err)
+	}
+	return nil
+}
+
+// title is the plain-text name of the profile in buttons and lists.
+func (e configEntry) title() string {
+	label := e.Label
+	if label == "" {
+		label = e.Name
+	}
+	if e.Emoji != "" {
+		label = e.Emoji + " " + label
+	}
+	return label
+}
+
+// buttonLabel fits the title into an inline button. The folder is already in
+// the list header, so only the base file name is shown; it is cut in the
+// middle to keep the extension, labels at the end.
+func (e configEntry) buttonLabel() string {
+	if e.Label == "" {
+		return strings.TrimSpace(e.Emoji + " " + shortenFileName(path.Base(e.Name)))
+	}
+	runes := []rune(e.title())
+	if len(runes) <= maxButtonLabelLength {
+		return string(runes)
+	}
+	return string(runes[:maxButtonLabelLength-1]) + "…"
+}
+
+// describeConfig names the profile in HTML messages: the label, and the file
+// name it resolves to when the two differ.
+func describeConfig(entry configEntry) string {
+	if entry.Label == "" && entry.Emoji == "" {
+		return fmt.Sprintf("<code>%s</code>", html.EscapeString(entry.Name))
+	}
+	return fmt.Sprintf("<b>%s</b> (<code>%s</code>)", html.EscapeString(entry.title()), html.EscapeString(entry.Name))
+}
+
+func formatConfigDescription(entry configEntry) string {
+	if entry.Description == "" {
+		return ""
+	}
+	return "\n<i>" + html.EscapeString(entry.Description) + "</i>"
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigRegistryLabels(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a-plain.json"), `{"outbounds": []}`)
+	writeTestFile(t, filepath.Join(dir, "b-remarks.json"), `{"remarks": " EU client "}`)
+	writeTestFile(t, filepath.Join(dir, "c-sidecar.json"), `{"remarks": "ignored"}`)
+	writeTestFile(t, filepath.Join(dir, "c-sidecar.meta"), `{"label": "Frankfurt", "emoji": "🇩🇪", "description": "Low latency", "order": 2}`)
+	writeTestFile(t, filepath.Join(dir, "d-first.json"), `{}`)
+	writeTestFile(t, filepath.Join(dir, "d-first.meta"), `{"emoji": "⭐", "order": 1}`)
+	writeTestFile(t, filepath.Join(dir, "e-broken.json"), `{}`)
+	writeTestFile(t, filepath.Join(dir, "e-broken.meta"), `not json`)
+
+	entries, err := newConfigRegistry(dir).list()
+	if err != nil {
+		t.Fatalf("list returned error: %v", err)
+	}
+	var titles []string
+	for _, entry := range entries {
+		titles = append(titles, entry.title())
+	}
+	want := []string{"⭐ d-first.json", "🇩🇪 Frankfurt", "a-plain.json", "EU client", "e-broken.json"}
+	if strings.Join(titles, "|") != strings.Join(want, "|") {
+		t.Fatalf("titles = %q, want %q", titles, want)
+	}
+
+	if got := describeConfig(entries[1]); got != "<b>🇩🇪 Frankfurt</b> (<code>c-sidecar.json</code>)" {
+		t.Fatalf("unexpected description: %s", got)
+	}
+	if got := formatConfigDescription(entries[1]); got != "\n<i>Low latency</i>" {
+		t.Fatalf("unexpected description line: %q", got)
+	}
+	if got := describeConfig(entries[2]); got != "<code>a-plain.json</code>" {
+		t.Fatalf("unexpected description: %s", got)
+	}
+}
+
+func TestReadProfileDataIsBounded(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.json")
+	writeTestFile(t, small, `{"remarks": "EU"}`)
+	if got := readRemarks(readProfileData(small)); got != "EU" {
+		t.Fatalf("unexpected remarks: %q", got)
+	}
+
+	large := filepath.Join(dir, "large.json")
+	writeTestFile(t, large, `{"remarks": "EU"}`)
+	if err := os.Truncate(large, maxProfileReadSize+1); err != nil {
+		t.Fatal(err)
+	}
+	if data := readProfileData(large); data != nil {
+		t.Fatalf("expected an oversized profile not to be read, got %d bytes", len(data))
+	}
+}
+
+func TestButtonLabel(t *testing.T) {
+	long := configEntry{Name: "x.json", configMeta: configMeta{Label: strings.Repeat("Сервер ", 10)}}
+	if label := []rune(long.buttonLabel()); len(label) != maxButtonLabelLength || label[len(label)-1] != '…' {
+		t.Fatalf("unexpected long label: %q", string(label))
+	}
+
+	file := configEntry{Name: "very-very-long-config-file-name.json"}
+	if label := file.buttonLabel(); label != shortenFileName(file.Name) {
+		t.Fatalf("unexpected file label: %q", label)
+	}
+}
+
+func TestMoveToTrashMovesMetadata(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.json"), `{}`)
+	writeTestFile(t, filepath.Join(dir, "a.meta"), `{"label": "A"}`)
+
+	trashPath, err := moveToTrash(dir, "a.json", time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("moveToTrash returned error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a.meta")); !os.IsNotExist(err) {
+		t.Fatalf("metadata is still in place: %v", err)
+	}
+	if data, err := os.ReadFile(metaPath(trashPath)); err != nil || string(data) != `{"label": "A"}` {
+		t.Fatalf("trashed metadata = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	actionRateLimit = "rate_limit"
+
+	rateLimitSlowDownText = "🐢 Slow down, please. Try again in a few seconds."
+	// rateLimitViolationWindow is how long a violation counts towards a ban.
+	rateLimitViolationWindow = time.Minute
+	// rateLimitPruneSize is the bucket count above which idle buckets are dropped.
+	rateLimitPruneSize = 1024
+)
+
+type rateDecision struct {
+	allowed bool
+	// notify is set for the first rejection of a streak and when a ban starts,
+	// so a flooding user gets one reply instead of one per update.
+	notify      bool
+	banned      bool
+	bannedUntil time.Time
+}
+
+type rateBucket struct {
+	tokens        float64
+	updatedAt     time.Time
+	violations    int
+	lastViolation time.Time
+	bannedUntil   time.Time
+}
+
+// rateLimiter is a per-user token bucket with temporary bans after
+// repeated violations.
+type rateLimiter struct {
+	mutex       sync.Mutex
+	rate        float64 // tokens per second
+	burst       float64
+	banAfter    int
+	banDuration time.Duration
+	buckets     map[int64]*rateBucket
+	now         func() time.Time
+}
+
+func newRateLimiter(perMinute, burst, banAfter int, banDuration time.Duration) *rateLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:        float64(perMinute) / 60,
+		burst:       float64(burst),
+		banAfter:    banAfter,
+		banDuration: banDuration,
+		buckets:     make(map[int64]*rateBucket),
+		now:         time.Now,
+	}
+}
+
+func WithRateLimit(perMinute, burst, banAfter int, banDuration time.Duration) Option {
+	return func(h *Handler) {
+		if perMinute <= 0 {
+			h.rateLimiter = nil
+			return
+		}
+		h.rateLimiter = newRateLimiter(perMinute, burst, banAfter, banDuration)
+	}
+}
+
+func (l *rateLimiter) allow(userID int64) rateDecision {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := l.now()
+	bucket, ok := l.buckets[userID]
+	if !ok {
+		l.prune(now)
+		bucket = &rateBucket{tokens: l.burst, updatedAt: now}
+		l.buckets[userID] = bucket
+	}
+
+	if now.Before(bucket.bannedUntil) {
+		return rateDecision{banned: true, bannedUntil: bucket.bannedUntil}
+	}
+
+	bucket.tokens += now.Sub(bucket.updatedAt).Seconds() * l.rate
+	if bucket.tokens > l.burst {
+		bucket.tokens = l.burst
+	}
+	bucket.updatedAt = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return rateDecision{allowed: true}
+	}
+
+	if now.Sub(bucket.lastViolation) > rateLimitViolationWindow {
+		bucket.violations = 0
+	}
+	notify := bucket.violations == 0
+	bucket.violations++
+	bucket.lastViolation = now
+
+	if l.banAfter > 0 && l.banDuration > 0 && bucket.violations >= l.banAfter {
+		bucket.violations = 0
+		bucket.bannedUntil = now.Add(l.banDuration)
+		return rateDecision{notify: true, banned: true, bannedUntil: bucket.bannedUntil}
+	}
+
+	return rateDecision{notify: notify}
+}
+
+func (l *rateLimiter) prune(now time.Time) {
+	if len(l.buckets) < rateLimitPruneSize {
+		return
+	}
+	for userID, bucket := range l.buckets {
+		idle := now.Sub(bucket.updatedAt).Seconds()*l.rate >= l.burst
+		if idle && now.After(bucket.bannedUntil) {
+			delete(l.buckets, userID)
+		}
+	}
+}
+
+// RateLimitMiddleware drops updates from users that exceed their rate and
+// answers them with a "slow down" reply instead of letting them contend for
+// the global command lock.
+func (h *Handler) RateLimitMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		sender, ok := getUpdateSender(update)
+		if h.rateLimiter == nil || !ok {
+			next(ctx, b, update)
+			return
+		}
+
+		decision := h.rateLimiter.allow(sender.userID)
+		if decision.allowed {
+			next(ctx, b, update)
+			return
+		}
+
+		if decision.notify {
+			fields := []zap.Field{
+				zap.Int64("user_id", sender.userID),
+				zap.String("username", sender.username),
+				zap.Int64("chat_id", sender.chatID),
+			}
+			if decision.banned {
+				h.logger.Named("security").Warn("user temporarily banned for flooding", append(fields, zap.Time("banned_until", decision.bannedUntil))...)
+			} else {
+				h.logger.Warn("rate limit exceeded", fields...)
+			}
+			h.recordAudit(audit.Entry{
+				UserID:   sender.userID,
+				Username: sender.username,
+				ChatID:   sender.chatID,
+				Action:   actionRateLimit,
+				Outcome:  audit.OutcomeDenied,
+			})
+		}
+		h.rejectRateLimited(ctx, b, update, sender, decision)
+	}
+}
+
+func (h *Handler) rejectRateLimited(ctx context.Context, b *bot.Bot, update *models.Update, sender updateSender, decision rateDecision) {
+	text := rateLimitSlowDownText
+	if decision.banned {
+		text = fmt.Sprintf("🚫 Too many requests. Try again in %s.", roundDurationToSeconds(time.Until(decision.bannedUntil)))
+	}
+
+	// Callback queries must always be answered, otherwise the button keeps
+	// spinning; messages only get a reply once per streak.
+	if update.CallbackQuery != nil {
+		if _, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			Text:            text,
+		}); err != nil {
+			h.logger.Warn("send slow down answer failed", zap.Error(err), zap.Int64("user_id", sender.userID))
+		}
+		return
+	}
+
+	if !decision.notify || update.Message == nil || update.Message.Chat.Type != models.ChatTypePrivate {
+		return
+	}
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: sender.chatID, Text: text}); err != nil {
+		h.logger.Warn("send slow down message failed", zap.Error(err), zap.Int64("chat_id", sender.chatID))
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTokenBucket(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	limiter := newRateLimiter(60, 2, 0, 0)
+	limiter.now = func() time.Time { return now }
+
+	if !limiter.allow(1).allowed || !limiter.allow(1).allowed {
+		t.Fatalf("expected burst of two updates to be allowed")
+	}
+
+	decision := limiter.allow(1)
+	if decision.allowed || !decision.notify {
+		t.Fatalf("expected first violation to be rejected with a reply: %+v", decision)
+	}
+	if decision := limiter.allow(1); decision.allowed || decision.notify {
+		t.Fatalf("expected repeated violation to be rejected silently: %+v", decision)
+	}
+	if !limiter.allow(2).allowed {
+		t.Fatalf("other users must not share the bucket")
+	}
+
+	now = now.Add(time.Second)
+	if !limiter.allow(1).allowed {
+		t.Fatalf("expected token to refill after one second")
+	}
+}
+
+func TestRateLimiterBan(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	limiter := newRateLimiter(60, 1, 3, 10*time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	limiter.allow(1)
+	limiter.allow(1)
+	limiter.allow(1)
+	decision := limiter.allow(1)
+	if !decision.banned || !decision.notify || !decision.bannedUntil.Equal(now.Add(10*time.Minute)) {
+		t.Fatalf("expected ban after three violations: %+v", decision)
+	}
+
+	now = now.Add(time.Minute)
+	if decision := limiter.allow(1); decision.allowed || !decision.banned || decision.notify {
+		t.Fatalf("expected silent rejection while banned: %+v", decision)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if !limiter.allow(1).allowed {
+		t.Fatalf("expected ban to expire")
+	}
+}
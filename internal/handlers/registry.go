@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// configIDLength keeps callback data well below Telegram's 64-byte limit
+// while leaving 72 bits of the hash to tell files apart.
+const configIDLength = 12
+
+var errConfigOutdated = errors.New("config id is not known")
+
+type configEntry struct {
+	ID   string
+	Name string
+	configMeta
+	// servers are the lower-cased server addresses the config is searched
+	// by, cached along with the metadata.
+	servers []string
+}
+
+// configRegistry assigns short, stable IDs to the files in xrayConfigsDir.
+// IDs are derived from the file name, so they survive bot restarts and only
+// change when a file is renamed or removed.
+//
+// What is read from a profile is cached until the profile or its sidecar
+// changes on disk, so a button press costs a stat per file, not a read.
+type configRegistry struct {
+	dir   string
+	mutex sync.Mutex
+	cache map[string]*cachedConfig
+}
+
+// fileStamp tells whether a file changed since it was last read. A missing
+// file has the zero stamp.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+type cachedConfig struct {
+	config fileStamp
+	meta   fileStamp
+	configMeta
+	servers []string
+	// sum is the hash of the profile as it is applied, computed against the
+	// base template with the stamp template.
+	sum      string
+	template fileStamp
+}
+
+func newConfigRegistry(dir string) *configRegistry {
+	return &configRegistry{dir: dir, cache: make(map[string]*cachedConfig)}
+}
+
+func (r *configRegistry) list() ([]configEntry, error) {
+	fileNames, err := listConfigFileNames(r.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read xray configs dir: %w", err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	entries := make([]configEntry, 0, len(fileNames))
+	seen := make(map[string]bool, len(fileNames))
+	for _, fileName := range fileNames {
+		seen[fileName] = true
+		cached := r.cached(fileName)
+		entries = append(entries, configEntry{
+			ID:         configID(fileName),
+			Name:       fileName,
+			configMeta: cached.configMeta,
+			servers:    cached.servers,
+		})
+	}
+	for fileName := range r.cache {
+		if !seen[fileName] {
+			delete(r.cache, fileName)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if (a.Order != 0) != (b.Order != 0) {
+			return a.Order != 0
+		}
+		if a.Order != b.Order {
+			return a.Order < b.Order
+		}
+		return a.Name < b.Name
+	})
+	return entries, nil
+}
+
+func (r *configRegistry) lookup(id string) (configEntry, error) {
+	entries, err := r.list()
+	if err != nil {
+		return configEntry{}, err
+	}
+
+	for _, entry := range entries {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return configEntry{}, fmt.Errorf("%w: %q", errConfigOutdated, id)
+}
+
+// cached returns the cache entry of fileName, read again when the profile or
+// its sidecar changed. Files are stamped before they are read, so a change
+// during the read is picked up next time. The caller holds the mutex.
+func (r *configRegistry) cached(fileName string) *cachedConfig {
+	configPath := filepath.Join(r.dir, filepath.FromSlash(fileName))
+	config, meta := statFile(configPath), statFile(metaPath(configPath))
+	if cached, ok := r.cache[fileName]; ok && cached.config == config && cached.meta == meta {
+		return cached
+	}
+	data := readProfileData(configPath)
+	cached := &cachedConfig{
+		config:     config,
+		meta:       meta,
+		configMeta: readConfigMeta(configPath, data),
+		servers:    searchServers(data),
+	}
+	r.cache[fileName] = cached
+	return cached
+}
+
+// profileSum returns the cached hash of the applied form of fileName, or
+// computes it when the profile or the base template changed since.
+func (r *configRegistry) profileSum(fileName string, template fileStamp, compute func() (string, error)) (string, error) {
+	r.mutex.Lock()
+	cached := r.cached(fileName)
+	if cached.sum != "" && cached.template == template {
+		sum := cached.sum
+		r.mutex.Unlock()
+		return sum, nil
+	}
+	config := cached.config
+	r.mutex.Unlock()
+
+	sum, err := compute()
+	if err != nil {
+		return "", err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if cached, ok := r.cache[fileName]; ok && cached.config == config {
+		cached.sum, cached.template = sum, template
+	}
+	return sum, nil
+}
+
+func configID(fileName string) string {
+	sum := sha256.Sum256([]byte(fileName))
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:configIDLength]
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigRegistryLookup(t *testing.T) {
+	configsDir := t.TempDir()
+	longName := strings.Repeat("очень-длинное-имя-", 5) + ".json"
+	writeTestFile(t, filepath.Join(configsDir, longName), `{}`)
+	writeTestFile(t, filepath.Join(configsDir, "client-eu.json"), `{}`)
+	writeTestFile(t, filepath.Join(configsDir, "config.json"), `{}`)
+
+	registry := newConfigRegistry(configsDir)
+	h := &Handler{callbacks: newCallbackCodec([]byte("test-secret"), time.Hour)}
+	entries, err := registry.list()
+	if err != nil {
+		t.Fatalf("list returned error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+
+	for _, entry := range entries {
+		if data := h.makeCopyFileCallbackData(entry.ID); len(data) > callbackDataMaxLength {
+			t.Fatalf("callback data too long for %q: %d bytes", entry.Name, len(data))
+		}
+		if entry.ID != configID(entry.Name) {
+			t.Fatalf("id is not stable for %q", entry.Name)
+		}
+
+		found, err := registry.lookup(entry.ID)
+		if err != nil || found.Name != entry.Name {
+			t.Fatalf("lookup(%s) = %+v, err=%v", entry.ID, found, err)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(configsDir, longName)); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if _, err := registry.lookup(configID(longName)); !errors.Is(err, errConfigOutdated) {
+		t.Fatalf("expected outdated error after removal, got: %v", err)
+	}
+}
+
+func TestConfigRegistryCachesUntilFilesChange(t *testing.T) {
+	configsDir := t.TempDir()
+	configPath := filepath.Join(configsDir, "client-eu.json")
+	writeTestFile(t, configPath, `{"remarks":"Frankfurt"}`)
+	stamp := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(configPath, stamp, stamp); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := newConfigRegistry(configsDir)
+	label := func() string {
+		t.Helper()
+		entries, err := registry.list()
+		if err != nil || len(entries) != 1 {
+			t.Fatalf("list = %+v, err=%v", entries, err)
+		}
+		return entries[0].Label
+	}
+	if got := label(); got != "Frankfurt" {
+		t.Fatalf("unexpected label: %q", got)
+	}
+
+	// Same size and time: the file is taken as unchanged and not read again.
+	writeTestFile(t, configPath, `{"remarks":"Amsterdam"}`)
+	if err := os.Chtimes(configPath, stamp, stamp); err != nil {
+		t.Fatal(err)
+	}
+	if got := label(); got != "Frankfurt" {
+		t.Fatalf("expected the cached label, got %q", got)
+	}
+
+	writeTestFile(t, metaPath(configPath), `{"label":"Germany"}`)
+	if got := label(); got != "Germany" {
+		t.Fatalf("expected a new sidecar to be read, got %q", got)
+	}
+
+	calls := 0
+	compute := func() (string, error) {
+		calls++
+		return "sum", nil
+	}
+	for range 2 {
+		if sum, err := registry.profileSum("client-eu.json", fileStamp{}, compute); err != nil || sum != "sum" {
+			t.Fatalf("profileSum = %q, err=%v", sum, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("expected the hash to be computed once, got %d", calls)
+	}
+	if _, err := registry.profileSum("client-eu.json", fileStamp{size: 1}, compute); err != nil || calls != 2 {
+		t.Fatalf("expected a template change to recompute the hash, calls=%d err=%v", calls, err)
+	}
+	writeTestFile(t, configPath, `{"remarks":"Amsterdam, NL"}`)
+	if _, err := registry.profileSum("client-eu.json", fileStamp{size: 1}, compute); err != nil || calls != 3 {
+		t.Fatalf("expected a profile change to recompute the hash, calls=%d err=%v", calls, err)
+	}
+}
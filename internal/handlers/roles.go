@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Role int
+
+const (
+	RoleViewer Role = iota + 1
+	RoleOperator
+	RoleAdmin
+)
+
+const (
+	actionMainMenu       = "main_menu"
+	actionListConfigs    = "list_configs"
+	actionSpeedtest      = "speedtest"
+	actionCopyConfig     = "copy_config"
+	actionRestartService = "restart_service"
+	actionTOTPEnroll     = "totp_enroll"
+	actionAuditLog       = "audit_log"
+	actionRollback       = "rollback"
+	actionDiffConfig     = "diff_config"
+	actionUploadConfig   = "upload_config"
+	actionExportConfig   = "export_config"
+	actionManageConfigs  = "manage_configs"
+	actionImportLinks    = "import_links"
+	actionSearchConfigs  = "search_configs"
+
+	actionRefreshSubscriptions = "refresh_subscriptions"
+)
+
+var actionRoles = map[string]Role{
+	actionMainMenu:       RoleViewer,
+	actionListConfigs:    RoleViewer,
+	actionSpeedtest:      RoleViewer,
+	actionCopyConfig:     RoleOperator,
+	actionRestartService: RoleAdmin,
+	actionTOTPEnroll:     RoleOperator,
+	actionAuditLog:       RoleAdmin,
+	actionRollback:       RoleOperator,
+	actionDiffConfig:     RoleOperator,
+	actionUploadConfig:   RoleAdmin,
+	actionExportConfig:   RoleOperator,
+	actionManageConfigs:  RoleAdmin,
+	actionImportLinks:    RoleAdmin,
+	actionSearchConfigs:  RoleViewer,
+
+	actionRefreshSubscriptions: RoleAdmin,
+}
+
+func ParseRole(value string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "viewer":
+		return RoleViewer, nil
+	case "operator":
+		return RoleOperator, nil
+	case "admin":
+		return RoleAdmin, nil
+	default:
+		return 0, fmt.Errorf("unsupported role: %s", value)
+	}
+}
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// Can reports whether the role is allowed to run the action. Unknown actions
+// are denied so that a new handler has to be registered here explicitly.
+func (r Role) Can(action string) bool {
+	required, ok := actionRoles[action]
+	if !ok {
+		return false
+	}
+	return r >= required
+}
+
+func WithRoles(roles map[int64]Role, defaultRole Role) Option {
+	return func(h *Handler) {
+		h.roles = roles
+		h.defaultRole = defaultRole
+	}
+}
+
+func (h *Handler) roleFor(userID int64) Role {
+	if role, ok := h.roles[userID]; ok {
+		return role
+	}
+	if h.defaultRole == 0 {
+		return RoleAdmin
+	}
+	return h.defaultRole
+}
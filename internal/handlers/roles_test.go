@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParseRole(t *testing.T) {
+	role, err := ParseRole(" Operator ")
+	if err != nil || role != RoleOperator {
+		t.Fatalf("unexpected role: %v, err=%v", role, err)
+	}
+
+	if _, err := ParseRole("root"); err == nil {
+		t.Fatal("expected unknown role to fail")
+	}
+}
+
+func TestRoleCan(t *testing.T) {
+	cases := []struct {
+		role   Role
+		action string
+		want   bool
+	}{
+		{RoleViewer, actionSpeedtest, true},
+		{RoleViewer, actionCopyConfig, false},
+		{RoleOperator, actionCopyConfig, true},
+		{RoleOperator, actionRestartService, false},
+		{RoleAdmin, actionRestartService, true},
+		{RoleAdmin, "unknown_action", false},
+	}
+
+	for _, tc := range cases {
+		if got := tc.role.Can(tc.action); got != tc.want {
+			t.Fatalf("%s.Can(%s) = %v, want %v", tc.role, tc.action, got, tc.want)
+		}
+	}
+}
+
+func TestRoleFor(t *testing.T) {
+	h := &Handler{logger: zap.NewNop()}
+	if got := h.roleFor(1); got != RoleAdmin {
+		t.Fatalf("expected admin without role config, got %s", got)
+	}
+
+	WithRoles(map[int64]Role{1: RoleOperator}, RoleViewer)(h)
+	if got := h.roleFor(1); got != RoleOperator {
+		t.Fatalf("expected operator, got %s", got)
+	}
+	if got := h.roleFor(2); got != RoleViewer {
+		t.Fatalf("expected default viewer, got %s", got)
+	}
+}
+
+func TestMainMenuKeyboardHidesForbiddenButtons(t *testing.T) {
+	h := &Handler{callbacks: newCallbackCodec([]byte("test-secret"), time.Hour)}
+	if rows := len(h.mainMenuKeyboard(RoleViewer).InlineKeyboard); rows != 2 {
+		t.Fatalf("expected viewer to see 2 buttons, got %d", rows)
+	}
+	if rows := len(h.mainMenuKeyboard(RoleAdmin).InlineKeyboard); rows != 3 {
+		t.Fatalf("expected admin to see 3 buttons, got %d", rows)
+	}
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/bonus2k/xray-tlg/internal/xrayconfig"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// maxSearchQueryLength separates searches from other text: a longer
+	// message is not taken as a search and opens the main menu as before.
+	maxSearchQueryLength = 64
+	// maxSearchTerms and maxSearchServers bound the work of one query per
+	// config; words past the limit are ignored.
+	maxSearchTerms   = 8
+	maxSearchServers = 16
+)
+
+// Scores of one query word against one field, best first.
+const (
+	scoreExact = 4 - iota
+	scoreWordPrefix
+	scoreSubstring
+	scoreSubsequence
+)
+
+// isSearchQuery reports whether a plain text message is a config search.
+func isSearchQuery(text string) bool {
+	text = strings.TrimSpace(text)
+	return text != "" && !strings.HasPrefix(text, "/") && utf8.RuneCountInString(text) <= maxSearchQueryLength
+}
+
+// SearchConfigsHandler answers a plain text message with the configs whose
+// file name, label or server addresses match it.
+func (h *Handler) SearchConfigsHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	sender, ok := getUpdateSender(update)
+	if !ok || update.Message == nil {
+		return
+	}
+	query := strings.TrimSpace(update.Message.Text)
+
+	started := time.Now()
+	req := callbackRequest{
+		chatID:   sender.chatID,
+		userID:   sender.userID,
+		username: sender.username,
+		role:     h.roleFor(sender.userID),
+		update:   update,
+		args:     []string{"query=" + query},
+	}
+
+	if !req.role.Can(actionSearchConfigs) {
+		h.logger.Warn("config search rejected by role", zap.Int64("user_id", req.userID), zap.Stringer("role", req.role))
+		h.recordCallbackAudit(req, actionSearchConfigs, audit.OutcomeDenied, nil, started)
+		h.sendText(ctx, b, req.chatID, fmt.Sprintf("⛔ Your role (%s) does not allow this action.", req.role))
+		return
+	}
+
+	release, err := h.acquireCommandLock(actionSearchConfigs)
+	if err != nil {
+		h.recordCallbackAudit(req, actionSearchConfigs, audit.OutcomeBusy, err, started)
+		h.sendBusyMessage(ctx, b, update, err)
+		return
+	}
+	defer release()
+
+	entries, err := h.registry.list()
+	if err != nil {
+		h.logger.Error("config search failed", zap.Error(err))
+		h.recordCallbackAudit(req, actionSearchConfigs, audit.OutcomeError, err, started)
+		h.sendHTML(ctx, b, req.chatID, "⚠️ Something went wrong. Please try again.", h.mainMenuKeyboard(req.role))
+		return
+	}
+	matches := searchConfigs(entries, query)
+	req.args = append(req.args, fmt.Sprintf("matches=%d", len(matches)))
+	h.logger.Info("config search", zap.Int("matches", len(matches)), zap.Int64("user_id", req.userID))
+	h.recordCallbackAudit(req, actionSearchConfigs, audit.OutcomeOK, nil, started)
+
+	if len(matches) == 0 {
+		h.sendHTML(ctx, b, req.chatID,
+			fmt.Sprintf("🔎 No configs match <code>%s</code>.", html.EscapeString(query)),
+			h.mainMenuKeyboard(req.role))
+		return
+	}
+
+	active := h.activeConfig().name
+	shown := matches[:min(len(matches), h.pageSize)]
+	h.sendHTML(ctx, b, req.chatID,
+		formatSearchText(query, shown, len(matches), active, !req.role.Can(actionCopyConfig)),
+		h.searchResultsKeyboard(shown, active, req.role))
+}
+
+// searchConfigs returns the entries that match every word of query, best
+// matches first. Entries that match equally well keep the list order. Only
+// cached fields are compared, so a query reads no files.
+func searchConfigs(entries []configEntry, query string) []configEntry {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return nil
+	}
+	terms = terms[:min(len(terms), maxSearchTerms)]
+
+	type match struct {
+		entry configEntry
+		score int
+	}
+	var matches []match
+	for _, entry := range entries {
+		if score := matchScore(searchFields(entry), terms); score > 0 {
+			matches = append(matches, match{entry: entry, score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	result := make([]configEntry, 0, len(matches))
+	for _, m := range matches {
+		result = append(result, m.entry)
+	}
+	return result
+}
+
+// searchFields are the lower-cased texts a config is found by. The label
+// carries the remarks of the config unless a sidecar overrides them.
+func searchFields(entry configEntry) []string {
+	fields := make([]string, 0, len(entry.servers)+2)
+	fields = append(fields, strings.ToLower(entry.Name), strings.ToLower(entry.Label))
+	return append(fields, entry.servers...)
+}
+
+// searchServers are taken from the config when the registry reads it.
+// Configs with many outbounds are cut to the first maxSearchServers addresses.
+func searchServers(config []byte) []string {
+	servers := xrayconfig.ServerAddresses(config)
+	servers = servers[:min(len(servers), maxSearchServers)]
+	for i, server := range servers {
+		servers[i] = strings.ToLower(server)
+	}
+	return servers
+}
+
+// matchScore sums the best score of each query word over the fields. A word
+// that matches no field rules the config out, so the result is zero.
+func matchScore(fields, terms []string) int {
+	total := 0
+	for _, term := range terms {
+		best := 0
+		for _, field := range fields {
+			best = max(best, termScore(field, term))
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	return total
+}
+
+// termScore tolerates missing letters, so "frnkfrt" still finds
+// "frankfurt.json". Short words must appear as they are, otherwise they
+// would match nearly everything.
+func termScore(field, term string) int {
+	switch {
+	case field == "":
+		return 0
+	case field == term:
+		return scoreExact
+	case hasWordPrefix(field, term):
+		return scoreWordPrefix
+	case strings.Contains(field, term):
+		return scoreSubstring
+	case utf8.RuneCountInString(term) >= 3 && isSubsequence(field, term):
+		return scoreSubsequence
+	default:
+		return 0
+	}
+}
+
+// hasWordPrefix reports whether a word of field, split at anything but
+// letters and digits, starts with term.
+func hasWordPrefix(field, term string) bool {
+	words := strings.FieldsFunc(field, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSubsequence(field, term string) bool {
+	rest := []rune(term)
+	for _, r := range field {
+		if len(rest) == 0 {
+			break
+		}
+		if r == rest[0] {
+			rest = rest[1:]
+		}
+	}
+	return len(rest) == 0
+}
+
+func formatSearchText(query string, shown []configEntry, total int, active string, listNames bool) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "🔎 Matches for <code>%s</code>: %d.", html.EscapeString(query), total)
+	if total > len(shown) {
+		fmt.Fprintf(&builder, " Showing the best %d, add words to narrow it down.", len(shown))
+	}
+	if !listNames {
+		builder.WriteString("\nTap a config to activate it.")
+		return builder.String()
+	}
+	for _, entry := range shown {
+		builder.WriteString("\n• " + html.EscapeString(entry.title()))
+		if entry.title() != entry.Name {
+			builder.WriteString(" (" + html.EscapeString(entry.Name) + ")")
+		}
+		if entry.Name == active {
+			builder.WriteString(" ✅")
+		}
+	}
+	return builder.String()
+}
+
+// searchResultsKeyboard is laid out like the config list. Results come from
+// any folder, so unlabeled configs are shown with their folder.
+func (h *Handler) searchResultsKeyboard(entries []configEntry, active string, role Role) *models.InlineKeyboardMarkup {
+	buttons := make([][]models.InlineKeyboardButton, 0, len(entries)+1)
+	if role.Can(actionCopyConfig) {
+		for _, entry := range entries {
+			label := entry.buttonLabel()
+			if entry.Label == "" {
+				label = strings.TrimSpace(entry.Emoji + " " + shortenFileName(entry.Name))
+			}
+			buttons = append(buttons, h.configRow(entry, label, active, role))
+		}
+	}
+	buttons = append(buttons, []models.InlineKeyboardButton{{Text: "⬅️ Back to Main Menu", CallbackData: h.callbacks.encode(CallbackMainMenu)}})
+	return &models.InlineKeyboardMarkup{InlineKeyboard: buttons}
+}
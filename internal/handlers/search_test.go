@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchConfigs(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "provider"), 0o755); err != nil {
+		t.Fatalf("mkdir failed: %v", err)
+	}
+	writeTestFile(t, filepath.Join(dir, "frankfurt.json"), `{"outbounds": [{"settings": {"vnext": [{"address": "de1.example.com"}]}}]}`)
+	writeTestFile(t, filepath.Join(dir, "provider", "NL.json"), `{"remarks": "Amsterdam fast", "outbounds": [{"settings": {"servers": [{"address": "203.0.113.7"}]}}]}`)
+	writeTestFile(t, filepath.Join(dir, "provider", "DE.json"), `{"remarks": "Berlin", "outbounds": [{"settings": {"servers": [{"address": "de2.example.com"}]}}]}`)
+
+	entries, err := newConfigRegistry(dir).list()
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "frnkfrt", want: []string{"frankfurt.json"}},
+		{query: "AMSTERDAM", want: []string{"provider/NL.json"}},
+		{query: "203.0.113", want: []string{"provider/NL.json"}},
+		// "provi-de-r" is a weaker match than a word starting with "de".
+		{query: "de", want: []string{"frankfurt.json", "provider/DE.json", "provider/NL.json"}},
+		{query: "provider fast", want: []string{"provider/NL.json"}},
+		{query: "tokyo", want: nil},
+		{query: "   ", want: nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, entry := range searchConfigs(entries, tt.query) {
+			got = append(got, entry.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("search %q = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestSearchConfigsUsesCachedBoundedFields(t *testing.T) {
+	dir := t.TempDir()
+	var servers []string
+	for i := range maxSearchServers + 1 {
+		servers = append(servers, fmt.Sprintf(`{"address": "node%d.example.com"}`, i))
+	}
+	writeTestFile(t, filepath.Join(dir, "many.json"), `{"outbounds": [{"settings": {"servers": [`+strings.Join(servers, ",")+`]}}]}`)
+
+	entries, err := newConfigRegistry(dir).list()
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	// Searching works on what the registry read, not on the files.
+	if err := os.Remove(filepath.Join(dir, "many.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		found bool
+	}{
+		{query: "node0.example.com", found: true},
+		{query: fmt.Sprintf("node%d.example.com", maxSearchServers), found: false},
+		{query: strings.Repeat("many ", maxSearchTerms) + "tokyo", found: true},
+	}
+	for _, tt := range tests {
+		if got := len(searchConfigs(entries, tt.query)) == 1; got != tt.found {
+			t.Errorf("search %q found=%v, want %v", tt.query, got, tt.found)
+		}
+	}
+}
+
+func TestIsSearchQuery(t *testing.T) {
+	for text, want := range map[string]bool{
+		"frankfurt":             true,
+		"  de  ":                true,
+		"":                      false,
+		"/unknown":              false,
+		strings.Repeat("a", 65): false,
+		strings.Repeat("я", 64): true,
+	} {
+		if got := isSearchQuery(text); got != want {
+			t.Errorf("isSearchQuery(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestSearchResultsKeyboard(t *testing.T) {
+	h := &Handler{callbacks: newCallbackCodec([]byte("test-secret"), time.Hour)}
+	entries := []configEntry{
+		{ID: configID("provider/DE.json"), Name: "provider/DE.json"},
+		{ID: configID("a.json"), Name: "a.json", configMeta: configMeta{Label: "Berlin"}},
+	}
+
+	rows := h.searchResultsKeyboard(entries, "a.json", RoleOperator).InlineKeyboard
+	if len(rows) != 3 || rows[0][0].Text != "provider/DE.json" || rows[1][0].Text != "✅ Berlin" {
+		t.Fatalf("unexpected operator keyboard: %+v", rows)
+	}
+	data, err := h.callbacks.decode(rows[0][0].CallbackData)
+	if err != nil || data.name != CallbackCopyConfig || data.args[0] != entries[0].ID {
+		t.Fatalf("unexpected apply button: %+v, err=%v", data, err)
+	}
+
+	if rows := h.searchResultsKeyboard(entries, "", RoleViewer).InlineKeyboard; len(rows) != 1 {
+		t.Fatalf("viewer should only get the back button, got %+v", rows)
+	}
+}
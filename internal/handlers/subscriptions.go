@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/bonus2k/xray-tlg/internal/subscription"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+// maxReportNames bounds every name list in a subscription report, so a
+// provider that reshuffles hundreds of servers still fits in one message.
+const maxReportNames = 20
+
+// WithSubscriptions keeps the configured subscriptions up to date.
+// Scheduled refreshes that change something or fail are reported to
+// notifyChatIDs.
+func WithSubscriptions(manager *subscription.Manager, notifyChatIDs []int64) Option {
+	return func(h *Handler) {
+		h.subscriptions = manager
+		h.notifyChatIDs = notifyChatIDs
+	}
+}
+
+// RunSubscriptions refreshes subscriptions on their schedule until ctx is
+// done. It returns right away when no subscriptions are configured.
+func (h *Handler) RunSubscriptions(ctx context.Context, b *bot.Bot) {
+	if h.subscriptions == nil {
+		return
+	}
+
+	h.subscriptions.Run(ctx, func(report subscription.Report, err error) {
+		h.recordSubscriptionRefresh(report, err)
+		if err == nil && !report.Changed() {
+			return
+		}
+		text := formatSubscriptionReport(report, err)
+		for _, chatID := range h.notifyChatIDs {
+			h.sendHTML(ctx, b, chatID, text, nil)
+		}
+	})
+}
+
+func (h *Handler) RefreshSubscriptionsHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionRefreshSubscriptions, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		if h.subscriptions == nil {
+			return errors.New("no subscriptions are configured")
+		}
+
+		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:    req.chatID,
+			MessageID: req.messageID,
+			Text:      "🔄 Refreshing subscriptions...",
+		}); err != nil {
+			return fmt.Errorf("set refresh progress message: %w", err)
+		}
+
+		reports := make([]string, 0, len(h.subscriptions.Sources()))
+		for _, source := range h.subscriptions.Sources() {
+			report, err := h.subscriptions.Refresh(ctx, source)
+			h.logSubscriptionRefresh(report, err)
+			if err != nil {
+				req.markOutcome(audit.OutcomeError)
+			}
+			req.annotate(subscriptionAuditArgs(report)...)
+			reports = append(reports, formatSubscriptionReport(report, err))
+		}
+
+		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      req.chatID,
+			MessageID:   req.messageID,
+			Text:        strings.Join(reports, "\n\n"),
+			ParseMode:   models.ParseModeHTML,
+			ReplyMarkup: h.mainMenuKeyboard(req.role),
+		}); err != nil {
+			return fmt.Errorf("set refresh report message: %w", err)
+		}
+		return nil
+	})
+}
+
+// recordSubscriptionRefresh audits a scheduled refresh. It has no user, so
+// user and chat stay zero.
+func (h *Handler) recordSubscriptionRefresh(report subscription.Report, err error) {
+	h.logSubscriptionRefresh(report, err)
+	entry := audit.Entry{
+		Action:  actionRefreshSubscriptions,
+		Args:    subscriptionAuditArgs(report),
+		Outcome: audit.OutcomeOK,
+	}
+	if err != nil {
+		entry.Outcome = audit.OutcomeError
+		entry.Error = err.Error()
+	}
+	h.recordAudit(entry)
+}
+
+func (h *Handler) logSubscriptionRefresh(report subscription.Report, err error) {
+	if err != nil {
+		h.logger.Warn("subscription refresh failed", zap.Error(err), zap.String("subscription", report.Source))
+		return
+	}
+	h.logger.Info("subscription refreshed",
+		zap.String("subscription", report.Source),
+		zap.Int("added", len(report.Added)),
+		zap.Int("removed", len(report.Removed)),
+		zap.Int("updated", len(report.Updated)),
+		zap.Int("unchanged", report.Unchanged),
+		zap.Int("skipped", len(report.Skipped)),
+	)
+}
+
+func subscriptionAuditArgs(report subscription.Report) []string {
+	return []string{
+		"subscription=" + report.Source,
+		fmt.Sprintf("added=%d", len(report.Added)),
+		fmt.Sprintf("removed=%d", len(report.Removed)),
+		fmt.Sprintf("updated=%d", len(report.Updated)),
+	}
+}
+
+func formatSubscriptionReport(report subscription.Report, err error) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "🔄 Subscription <code>%s</code>", html.EscapeString(report.Source))
+	if err != nil {
+		fmt.Fprintf(&builder, ": ❌ %s", html.EscapeString(err.Error()))
+	} else {
+		fmt.Fprintf(&builder, ": %d added, %d removed, %d updated, %d unchanged.",
+			len(report.Added), len(report.Removed), len(report.Updated), report.Unchanged)
+	}
+
+	writeNames := func(marker string, names []string) {
+		for _, name := range names[:min(len(names), maxReportNames)] {
+			fmt.Fprintf(&builder, "\n%s <code>%s</code>", marker, html.EscapeString(name))
+		}
+		if len(names) > maxReportNames {
+			fmt.Fprintf(&builder, "\n%s and %d more", marker, len(names)-maxReportNames)
+		}
+	}
+	writeNames("➕", report.Added)
+	writeNames("➖", report.Removed)
+	writeNames("✏️", report.Updated)
+
+	if len(report.Skipped) > 0 {
+		fmt.Fprintf(&builder, "\n⚠️ Skipped %d links:", len(report.Skipped))
+		for _, reason := range report.Skipped[:min(len(report.Skipped), maxReportNames)] {
+			fmt.Fprintf(&builder, "\n• %s", html.EscapeString(reason))
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bonus2k/xray-tlg/internal/subscription"
+)
+
+func TestFormatSubscriptionReport(t *testing.T) {
+	added := make([]string, maxReportNames+5)
+	for i := range added {
+		added[i] = fmt.Sprintf("server-%d.json", i)
+	}
+	text := formatSubscriptionReport(subscription.Report{
+		Source:    "provider",
+		Added:     added,
+		Removed:   []string{"<old>.json"},
+		Unchanged: 3,
+		Skipped:   []string{"link 4: unsupported share link scheme"},
+	}, nil)
+
+	for _, want := range []string{
+		"<code>provider</code>: 25 added, 1 removed, 0 updated, 3 unchanged.",
+		"➕ <code>server-19.json</code>",
+		"➕ and 5 more",
+		"➖ <code>&lt;old&gt;.json</code>",
+		"⚠️ Skipped 1 links:\n• link 4: unsupported share link scheme",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("report does not contain %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "server-20.json") {
+		t.Fatalf("report lists more than %d names:\n%s", maxReportNames, text)
+	}
+
+	text = formatSubscriptionReport(subscription.Report{Source: "provider"}, errors.New("download subscription: 500 Internal Server Error"))
+	if text != "🔄 Subscription <code>provider</code>: ❌ download subscription: 500 Internal Server Error" {
+		t.Fatalf("unexpected error report: %s", text)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bonus2k/xray-tlg/internal/xrayconfig"
+)
+
+// WithTemplate makes profiles without inbounds outbound snippets: they are
+// merged into the base template at path whenever they are applied, compared
+// or validated. The template is read each time, so edits to it reach every
+// snippet on its next apply. An empty path disables composition.
+func WithTemplate(path string) Option {
+	return func(h *Handler) {
+		h.templatePath = path
+	}
+}
+
+// readProfile returns the config the profile at path turns into when it is
+// applied.
+func (h *Handler) readProfile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+	return h.composeProfile(data)
+}
+
+func (h *Handler) composeProfile(data []byte) ([]byte, error) {
+	if h.templatePath == "" || !xrayconfig.IsSnippet(data) {
+		return data, nil
+	}
+	template, err := os.ReadFile(h.templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("read base template: %w", err)
+	}
+	return xrayconfig.Compose(template, data)
+}
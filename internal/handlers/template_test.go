@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestSnippetIsComposedOnApply(t *testing.T) {
+	configsDir := t.TempDir()
+	activePath := filepath.Join(t.TempDir(), "config.json")
+	templatePath := filepath.Join("..", "..", "testdata", "templates", "base.json")
+	writeTestFile(t, filepath.Join(configsDir, "eu.json"), `{"remarks": "EU", "outbounds": [{"protocol": "vless", "tag": "proxy"}]}`)
+	writeTestFile(t, filepath.Join(configsDir, "full.json"), `{"inbounds": [{"port": 1081, "protocol": "socks"}], "outbounds": [{"protocol": "freedom"}]}`)
+
+	h := &Handler{
+		xrayConfigsDir: configsDir,
+		xrayConfigPath: activePath,
+		logger:         zap.NewNop(),
+		registry:       newConfigRegistry(configsDir),
+		templatePath:   templatePath,
+	}
+
+	full, err := h.readProfile(filepath.Join(configsDir, "full.json"))
+	if err != nil || !strings.Contains(string(full), "1081") || strings.Contains(string(full), "geoip") {
+		t.Fatalf("full config must be applied as is, got %s (%v)", full, err)
+	}
+
+	data, err := h.readProfile(filepath.Join(configsDir, "eu.json"))
+	if err != nil {
+		t.Fatalf("readProfile returned error: %v", err)
+	}
+	if err := h.installActiveConfig(callbackRequest{}, data, "eu.json", h.configChecks(context.Background())...); err != nil {
+		t.Fatalf("installActiveConfig returned error: %v", err)
+	}
+	active, err := os.ReadFile(activePath)
+	if err != nil {
+		t.Fatalf("read active config failed: %v", err)
+	}
+	for _, want := range []string{`"geoip:private"`, `"tag": "proxy"`, `"tag": "block"`} {
+		if !strings.Contains(string(active), want) {
+			t.Fatalf("active config does not contain %s:\n%s", want, active)
+		}
+	}
+	if name := h.detectConfigSource(activePath); name != "eu.json" {
+		t.Fatalf("detectConfigSource = %q, want eu.json", name)
+	}
+
+	h.templatePath = filepath.Join(t.TempDir(), "missing.json")
+	if _, err := h.readProfile(filepath.Join(configsDir, "eu.json")); err == nil {
+		t.Fatalf("expected error for a missing base template")
+	}
+}
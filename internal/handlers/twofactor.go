@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/bonus2k/xray-tlg/internal/totp"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/skip2/go-qrcode"
+	"go.uber.org/zap"
+)
+
+const totpIssuer = "xray-tlg"
+
+func WithTOTP(secrets map[int64]string) Option {
+	return func(h *Handler) {
+		h.totpSecrets = secrets
+	}
+}
+
+// runWithSecondFactor runs the operation right away for users without a TOTP
+// secret. Otherwise it asks for a code and runs the operation once the next
+// message of the user validates.
+func (h *Handler) runWithSecondFactor(
+	ctx context.Context,
+	b *bot.Bot,
+	req callbackRequest,
+	action string,
+	prompt string,
+	run func(context.Context, *bot.Bot, callbackRequest) error,
+) error {
+	secret, ok := h.totpSecrets[req.userID]
+	if !ok {
+		return run(ctx, b, req)
+	}
+
+	req.markOutcome(audit.OutcomePending)
+	h.awaitInput(req.userID, req.chatID, func(ctx context.Context, b *bot.Bot, message *models.Message) {
+		started := time.Now()
+		req.audit = &auditNote{}
+		h.deleteMessage(ctx, b, message.Chat.ID, message.ID)
+
+		if !h.checkTOTP(req.userID, secret, message.Text) {
+			h.logger.Named("security").Warn("totp validation failed",
+				zap.String("action", action),
+				zap.Int64("user_id", req.userID),
+				zap.Int64("chat_id", req.chatID),
+			)
+			h.recordCallbackAudit(req, action, audit.OutcomeDenied, errors.New("invalid totp code"), started)
+			if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+				ChatID:      req.chatID,
+				MessageID:   req.messageID,
+				Text:        "❌ Invalid code, nothing was changed.",
+				ReplyMarkup: h.mainMenuKeyboard(req.role),
+			}); err != nil {
+				h.logger.Warn("set invalid code message failed", zap.Error(err), zap.Int64("chat_id", req.chatID))
+			}
+			return
+		}
+
+		release, err := h.acquireCommandLock(action)
+		if err != nil {
+			h.recordCallbackAudit(req, action, audit.OutcomeBusy, err, started)
+			h.sendBusyMessage(ctx, b, &models.Update{Message: message}, err)
+			return
+		}
+		defer release()
+
+		h.logger.Info("totp validated", zap.String("action", action), zap.Int64("user_id", req.userID))
+		h.executeCommand(ctx, b, req, action, run)
+	})
+
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    req.chatID,
+		MessageID: req.messageID,
+		Text:      fmt.Sprintf("🔐 %s\n\nSend the 6-digit code from your authenticator app within %s.", prompt, roundDurationToSeconds(defaultInputTimeout)),
+		ParseMode: models.ParseModeHTML,
+		ReplyMarkup: &models.InlineKeyboardMarkup{
+			InlineKeyboard: [][]models.InlineKeyboardButton{
+				{{Text: "❌ Cancel", CallbackData: h.callbacks.encode(CallbackMainMenu)}},
+			},
+		},
+	}); err != nil {
+		h.cancelInput(req.userID)
+		return fmt.Errorf("set totp prompt message: %w", err)
+	}
+	return nil
+}
+
+// checkTOTP validates the code and refuses to accept the same time step twice
+// for one user, so an observed code cannot be replayed.
+func (h *Handler) checkTOTP(userID int64, secret, code string) bool {
+	step, ok := totp.Validate(secret, code, time.Now())
+	if !ok {
+		return false
+	}
+
+	h.inputMutex.Lock()
+	defer h.inputMutex.Unlock()
+
+	if h.totpLastStep == nil {
+		h.totpLastStep = make(map[int64]int64)
+	}
+	if step <= h.totpLastStep[userID] {
+		return false
+	}
+	h.totpLastStep[userID] = step
+	return true
+}
+
+func (h *Handler) TOTPEnrollHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	sender, ok := getUpdateSender(update)
+	if !ok || update.Message == nil {
+		return
+	}
+
+	started := time.Now()
+	req := callbackRequest{chatID: sender.chatID, userID: sender.userID, username: sender.username}
+
+	role := h.roleFor(sender.userID)
+	if !role.Can(actionTOTPEnroll) {
+		h.logger.Warn("totp enrolment rejected by role", zap.Int64("user_id", sender.userID), zap.Stringer("role", role))
+		h.recordCallbackAudit(req, actionTOTPEnroll, audit.OutcomeDenied, nil, started)
+		h.sendText(ctx, b, sender.chatID, fmt.Sprintf("⛔ Your role (%s) does not allow this action.", role))
+		return
+	}
+	if update.Message.Chat.Type != models.ChatTypePrivate {
+		h.recordCallbackAudit(req, actionTOTPEnroll, audit.OutcomeRejected, errors.New("not a private chat"), started)
+		h.sendText(ctx, b, sender.chatID, "🔐 Send /totp in a private chat with the bot.")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		h.logger.Error("totp secret generation failed", zap.Error(err))
+		h.recordCallbackAudit(req, actionTOTPEnroll, audit.OutcomeError, err, started)
+		h.sendText(ctx, b, sender.chatID, "⚠️ Something went wrong. Please try again.")
+		return
+	}
+
+	account := sender.username
+	if account == "" {
+		account = fmt.Sprint(sender.userID)
+	}
+	uri := totp.URI(secret, totpIssuer, account)
+
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		h.logger.Error("totp qr generation failed", zap.Error(err))
+		h.recordCallbackAudit(req, actionTOTPEnroll, audit.OutcomeError, err, started)
+		h.sendText(ctx, b, sender.chatID, "⚠️ Something went wrong. Please try again.")
+		return
+	}
+
+	caption := fmt.Sprintf(
+		"🔐 Scan this code with your authenticator app.\n\nThen ask an admin to add it to the bot config and restart the bot:\n<code>\"totp_secrets\": {\"%d\": \"%s\"}</code>\n\n<code>%s</code>",
+		sender.userID, secret, html.EscapeString(uri),
+	)
+	if _, err := b.SendPhoto(ctx, &bot.SendPhotoParams{
+		ChatID:         sender.chatID,
+		Photo:          &models.InputFileUpload{Filename: "totp.png", Data: bytes.NewReader(png)},
+		Caption:        caption,
+		ParseMode:      models.ParseModeHTML,
+		ProtectContent: true,
+	}); err != nil {
+		h.logger.Error("send totp enrolment failed", zap.Error(err), zap.Int64("chat_id", sender.chatID))
+		h.recordCallbackAudit(req, actionTOTPEnroll, audit.OutcomeError, err, started)
+		return
+	}
+
+	h.logger.Info("totp secret generated", zap.Int64("user_id", sender.userID))
+	h.recordCallbackAudit(req, actionTOTPEnroll, audit.OutcomeOK, nil, started)
+}
+
+func (h *Handler) sendText(ctx context.Context, b *bot.Bot, chatID int64, text string) {
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: text}); err != nil {
+		h.logger.Warn("send message failed", zap.Error(err), zap.Int64("chat_id", chatID))
+	}
+}
+
+func (h *Handler) deleteMessage(ctx context.Context, b *bot.Bot, chatID int64, messageID int) {
+	if _, err := b.DeleteMessage(ctx, &bot.DeleteMessageParams{ChatID: chatID, MessageID: messageID}); err != nil {
+		h.logger.Debug("delete message failed", zap.Error(err), zap.Int64("chat_id", chatID))
+	}
+}
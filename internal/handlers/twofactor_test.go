@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/totp"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func TestCheckTOTPRejectsReplay(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret returned error: %v", err)
+	}
+	code, err := totp.Code(secret, time.Now())
+	if err != nil {
+		t.Fatalf("Code returned error: %v", err)
+	}
+
+	h := &Handler{}
+	if !h.checkTOTP(1, secret, code) {
+		t.Fatal("expected valid code to be accepted")
+	}
+	if h.checkTOTP(1, secret, code) {
+		t.Fatal("expected reused code to be rejected")
+	}
+	if h.checkTOTP(2, secret, "abcdef") {
+		t.Fatal("expected wrong code to be rejected")
+	}
+}
+
+func TestTakeInput(t *testing.T) {
+	h := &Handler{}
+	handle := func(context.Context, *bot.Bot, *models.Message) {}
+
+	h.awaitInput(1, 10, handle)
+	if _, ok := h.takeInput(1, 20); ok {
+		t.Fatal("expected input from another chat to be ignored")
+	}
+
+	h.awaitInput(1, 10, handle)
+	if _, ok := h.takeInput(1, 10); !ok {
+		t.Fatal("expected pending input to be returned")
+	}
+	if _, ok := h.takeInput(1, 10); ok {
+		t.Fatal("expected pending input to be consumed")
+	}
+
+	h.awaitInput(1, 10, handle)
+	h.inputs[1] = pendingInput{chatID: 10, expiresAt: time.Now().Add(-time.Second), handle: handle}
+	if _, ok := h.takeInput(1, 10); ok {
+		t.Fatal("expected expired input to be dropped")
+	}
+}
@@ -0,0 +1,427 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/bonus2k/xray-tlg/internal/xrayconfig"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDownloadTimeout = 30 * time.Second
+	maxConfigNameLength    = 64
+	configFileMode         = 0o640
+)
+
+var (
+	errUploadTooLarge = errors.New("file is too large")
+	configNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+)
+
+// pendingUpload is a validated config waiting for the user to confirm that
+// it may overwrite an existing file.
+type pendingUpload struct {
+	name      string
+	data      []byte
+	expiresAt time.Time
+}
+
+// WithUploads lets users send configs as JSON documents of up to maxSize
+// bytes; a zero or negative size disables uploads.
+func WithUploads(maxSize int) Option {
+	return func(h *Handler) {
+		h.uploadMaxSize = int64(maxSize)
+	}
+}
+
+func (h *Handler) UploadConfigHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	sender, ok := getUpdateSender(update)
+	if !ok || update.Message == nil || update.Message.Document == nil {
+		return
+	}
+	document := update.Message.Document
+
+	started := time.Now()
+	req := callbackRequest{
+		chatID:   sender.chatID,
+		userID:   sender.userID,
+		username: sender.username,
+		role:     h.roleFor(sender.userID),
+		update:   update,
+		args:     []string{"upload=" + document.FileName},
+	}
+
+	if !req.role.Can(actionUploadConfig) {
+		h.logger.Warn("config upload rejected by role", zap.Int64("user_id", req.userID), zap.Stringer("role", req.role))
+		h.recordCallbackAudit(req, actionUploadConfig, audit.OutcomeDenied, nil, started)
+		h.sendText(ctx, b, req.chatID, fmt.Sprintf("⛔ Your role (%s) does not allow this action.", req.role))
+		return
+	}
+	if h.uploadMaxSize <= 0 {
+		h.recordCallbackAudit(req, actionUploadConfig, audit.OutcomeRejected, errors.New("uploads are disabled"), started)
+		h.sendText(ctx, b, req.chatID, "📥 Uploading configs is disabled.")
+		return
+	}
+	if !strings.EqualFold(filepath.Ext(document.FileName), ".json") {
+		h.recordCallbackAudit(req, actionUploadConfig, audit.OutcomeRejected, errors.New("not a json file"), started)
+		h.sendText(ctx, b, req.chatID, "📥 Send the config as a .json file.")
+		return
+	}
+	if document.FileSize > h.uploadMaxSize {
+		h.recordCallbackAudit(req, actionUploadConfig, audit.OutcomeRejected, errUploadTooLarge, started)
+		h.sendText(ctx, b, req.chatID, fmt.Sprintf("📥 The file is too large, the limit is %d bytes.", h.uploadMaxSize))
+		return
+	}
+
+	release, err := h.acquireCommandLock(actionUploadConfig)
+	if err != nil {
+		h.recordCallbackAudit(req, actionUploadConfig, audit.OutcomeBusy, err, started)
+		h.sendBusyMessage(ctx, b, update, err)
+		return
+	}
+	defer release()
+
+	h.logger.Info("config upload received", zap.String("file", document.FileName), zap.Int64("size", document.FileSize), zap.Int64("user_id", req.userID))
+	data, err := h.downloadDocument(ctx, b, document)
+	if errors.Is(err, errUploadTooLarge) {
+		h.recordCallbackAudit(req, actionUploadConfig, audit.OutcomeRejected, err, started)
+		h.sendText(ctx, b, req.chatID, fmt.Sprintf("📥 The file is too large, the limit is %d bytes.", h.uploadMaxSize))
+		return
+	}
+	if err != nil {
+		h.logger.Error("download uploaded config failed", zap.Error(err), zap.String("file", document.FileName))
+		h.recordCallbackAudit(req, actionUploadConfig, audit.OutcomeError, err, started)
+		h.sendText(ctx, b, req.chatID, "⚠️ Could not download the file. Please try again.")
+		return
+	}
+
+	if text, err := h.validateUpload(ctx, document.FileName, data); err != nil {
+		h.logger.Warn("uploaded config rejected", zap.String("file", document.FileName), zap.Error(err))
+		h.recordCallbackAudit(req, actionUploadConfig, audit.OutcomeRejected, err, started)
+		h.sendHTML(ctx, b, req.chatID, text, nil)
+		return
+	}
+
+	h.askUploadName(ctx, b, req, data, suggestConfigName(document.FileName), "")
+	h.recordCallbackAudit(req, actionUploadConfig, audit.OutcomePending, nil, started)
+}
+
+// askUploadName waits for the file name to store the upload under. Invalid
+// names are asked for again.
+func (h *Handler) askUploadName(ctx context.Context, b *bot.Bot, req callbackRequest, data []byte, suggested, notice string) {
+	h.awaitInput(req.userID, req.chatID, func(ctx context.Context, b *bot.Bot, message *models.Message) {
+		started := time.Now()
+
+		name, err := normalizeConfigName(message.Text)
+		if err == nil && h.isActiveConfigPath(filepath.Join(h.xrayConfigsDir, name)) {
+			err = errors.New("this is the active config itself")
+		}
+		if err != nil {
+			h.askUploadName(ctx, b, req, data, suggested, fmt.Sprintf("⚠️ %s.\n\n", err))
+			return
+		}
+
+		req.args = []string{"name=" + name}
+		if _, err := os.Lstat(filepath.Join(h.xrayConfigsDir, name)); err == nil {
+			h.confirmUploadOverwrite(ctx, b, req, name, data)
+			h.recordCallbackAudit(req, actionUploadConfig, audit.OutcomePending, nil, started)
+			return
+		}
+
+		release, err := h.acquireCommandLock(actionUploadConfig)
+		if err != nil {
+			h.recordCallbackAudit(req, actionUploadConfig, audit.OutcomeBusy, err, started)
+			h.sendBusyMessage(ctx, b, &models.Update{Message: message}, err)
+			return
+		}
+		defer release()
+
+		err = h.saveUpload(ctx, b, req, name, data)
+		outcome := audit.OutcomeOK
+		if err != nil {
+			outcome = audit.OutcomeError
+		}
+		h.recordCallbackAudit(req, actionUploadConfig, outcome, err, started)
+	})
+
+	text := notice + "📥 The config is valid. Send a name to save it under"
+	if suggested != "" {
+		text += fmt.Sprintf(", e.g. <code>%s</code>", html.EscapeString(suggested))
+	}
+	text += "."
+	h.sendHTML(ctx, b, req.chatID, text, h.uploadCancelKeyboard())
+}
+
+func (h *Handler) confirmUploadOverwrite(ctx context.Context, b *bot.Bot, req callbackRequest, name string, data []byte) {
+	h.inputMutex.Lock()
+	if h.uploads == nil {
+		h.uploads = make(map[int64]pendingUpload)
+	}
+	h.uploads[req.userID] = pendingUpload{name: name, data: data, expiresAt: time.Now().Add(defaultInputTimeout)}
+	h.inputMutex.Unlock()
+
+	h.sendHTML(ctx, b, req.chatID,
+		fmt.Sprintf("❓ <code>%s</code> already exists. Overwrite it?", html.EscapeString(name)),
+		&models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: "✅ Overwrite", CallbackData: h.callbacks.encode(CallbackUploadOverwrite, configID(name))}},
+			{{Text: "❌ Cancel", CallbackData: h.callbacks.encode(CallbackUploadCancel)}},
+		}},
+	)
+}
+
+func (h *Handler) ConfirmUploadOverwriteHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionUploadConfig, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		if len(req.args) != 1 {
+			return fmt.Errorf("upload callback expects 1 argument, got %d", len(req.args))
+		}
+
+		upload, ok := h.takeUpload(req.userID)
+		if !ok || configID(upload.name) != req.args[0] {
+			if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+				ChatID:      req.chatID,
+				MessageID:   req.messageID,
+				Text:        "⌛ This upload has expired. Send the file again.",
+				ReplyMarkup: h.mainMenuKeyboard(req.role),
+			}); err != nil {
+				return fmt.Errorf("set upload expired message: %w", err)
+			}
+			return nil
+		}
+		req.annotate("name=" + upload.name)
+
+		h.deleteMessage(ctx, b, req.chatID, req.messageID)
+		return h.saveUpload(ctx, b, req, upload.name, upload.data)
+	})
+}
+
+func (h *Handler) CancelUploadHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.handleCallbackCommand(ctx, b, update, actionUploadConfig, func(ctx context.Context, b *bot.Bot, req callbackRequest) error {
+		h.cancelInput(req.userID)
+		h.takeUpload(req.userID)
+
+		if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:      req.chatID,
+			MessageID:   req.messageID,
+			Text:        "📥 Upload cancelled.",
+			ReplyMarkup: h.mainMenuKeyboard(req.role),
+		}); err != nil {
+			return fmt.Errorf("set upload cancelled message: %w", err)
+		}
+		return nil
+	})
+}
+
+func (h *Handler) takeUpload(userID int64) (pendingUpload, bool) {
+	h.inputMutex.Lock()
+	defer h.inputMutex.Unlock()
+
+	upload, ok := h.uploads[userID]
+	delete(h.uploads, userID)
+	if !ok || time.Now().After(upload.expiresAt) {
+		return pendingUpload{}, false
+	}
+	return upload, true
+}
+
+func (h *Handler) saveUpload(ctx context.Context, b *bot.Bot, req callbackRequest, name string, data []byte) error {
+	if err := writeConfigFile(h.xrayConfigsDir, name, data); err != nil {
+		h.logger.Error("save uploaded config failed", zap.Error(err), zap.String("file", name))
+		h.sendText(ctx, b, req.chatID, "⚠️ Could not save the config. Please try again.")
+		return err
+	}
+	h.logger.Info("uploaded config saved", zap.String("file", name), zap.Int64("user_id", req.userID))
+
+	buttons := make([][]models.InlineKeyboardButton, 0, 2)
+	if req.role.Can(actionCopyConfig) {
+		buttons = append(buttons, []models.InlineKeyboardButton{{Text: "✅ Apply now", CallbackData: h.makeCopyFileCallbackData(configID(name))}})
+	}
+	buttons = append(buttons, []models.InlineKeyboardButton{{Text: "⬅️ Back to Main Menu", CallbackData: h.callbacks.encode(CallbackMainMenu)}})
+	h.sendHTML(ctx, b, req.chatID,
+		fmt.Sprintf("✅ Saved <code>%s</code> to the configs directory.", html.EscapeString(name)),
+		&models.InlineKeyboardMarkup{InlineKeyboard: buttons},
+	)
+	return nil
+}
+
+// validateUpload runs the same checks as apply against a temp copy of the
+// upload, merged into the base template when it is a snippet. It returns the
+// message to show when the config is rejected.
+func (h *Handler) validateUpload(ctx context.Context, fileName string, data []byte) (string, error) {
+	data, err := h.composeProfile(data)
+	if err != nil {
+		return fmt.Sprintf("❌ Config <code>%s</code> cannot be merged into the base template: %s", html.EscapeString(fileName), html.EscapeString(err.Error())), err
+	}
+
+	file, err := os.CreateTemp("", "xray-tlg-upload-*.json")
+	if err != nil {
+		return "⚠️ Something went wrong. Please try again.", fmt.Errorf("create upload temp file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		return "⚠️ Something went wrong. Please try again.", fmt.Errorf("write upload temp file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "⚠️ Something went wrong. Please try again.", fmt.Errorf("close upload temp file: %w", err)
+	}
+
+	for _, check := range h.configChecks(ctx) {
+		err := check(file.Name())
+		var invalid *xrayconfig.ValidationError
+		var rejected *validatorError
+		switch {
+		case errors.As(err, &invalid):
+			return formatValidationProblems(fileName, "saved", invalid.Problems), err
+		case errors.As(err, &rejected):
+			return formatValidatorFailure(fileName, rejected), err
+		case err != nil:
+			return "⚠️ Something went wrong. Please try again.", err
+		}
+	}
+	return "", nil
+}
+
+func (h *Handler) downloadDocument(ctx context.Context, b *bot.Bot, document *models.Document) ([]byte, error) {
+	file, err := b.GetFile(ctx, &bot.GetFileParams{FileID: document.FileID})
+	if err != nil {
+		return nil, fmt.Errorf("get file: %w", err)
+	}
+	if file.FileSize > h.uploadMaxSize {
+		return nil, errUploadTooLarge
+	}
+	return fetchURL(ctx, h.httpClient, b.FileDownloadLink(file), h.uploadMaxSize)
+}
+
+// fetchURL downloads at most limit bytes. Errors never include the URL,
+// because file download links contain the bot token.
+func fetchURL(ctx context.Context, client *http.Client, link string, limit int64) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, errors.New("invalid download url")
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed: %s", response.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("read download: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, errUploadTooLarge
+	}
+	return data, nil
+}
+
+// writeConfigFile stores data in dir atomically, so the config list never
+// shows a half-written profile under its final name.
+func writeConfigFile(dir, name string, data []byte) error {
+	file, err := os.CreateTemp(dir, ".upload-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create config temp file: %w", err)
+	}
+	tempPath := file.Name()
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("write config temp file: %w", err)
+	}
+	if err := file.Chmod(configFileMode); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("chmod config temp file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("close config temp file: %w", err)
+	}
+	if err := os.Rename(tempPath, filepath.Join(dir, name)); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("store config file: %w", err)
+	}
+	return nil
+}
+
+// normalizeConfigName turns user input into a config file name: a .json
+// suffix is added when missing and only a conservative character set is
+// accepted, so the name is safe in paths, callback data and HTML.
+func normalizeConfigName(input string) (string, error) {
+	name := strings.TrimSpace(input)
+	if name == "" {
+		return "", errors.New("the name is empty")
+	}
+	if !strings.HasSuffix(strings.ToLower(name), ".json") {
+		name += ".json"
+	}
+	if len(name) > maxConfigNameLength {
+		return "", fmt.Errorf("the name is longer than %d characters", maxConfigNameLength)
+	}
+	if !configNamePattern.MatchString(name) || !isPlainFileName(name) {
+		return "", errors.New("use only letters, digits, dots, dashes and underscores")
+	}
+	if name == "config.json" {
+		return "", errors.New("config.json is reserved")
+	}
+	return name, nil
+}
+
+func suggestConfigName(fileName string) string {
+	name, err := normalizeConfigName(filepath.Base(fileName))
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+func (h *Handler) isActiveConfigPath(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	activeInfo, err := os.Stat(h.xrayConfigPath)
+	return err == nil && os.SameFile(info, activeInfo)
+}
+
+func (h *Handler) uploadCancelKeyboard() *models.InlineKeyboardMarkup {
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+		{{Text: "❌ Cancel", CallbackData: h.callbacks.encode(CallbackUploadCancel)}},
+	}}
+}
+
+func (h *Handler) sendHTML(ctx context.Context, b *bot.Bot, chatID int64, text string, keyboard models.ReplyMarkup) {
+	if _, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: keyboard,
+	}); err != nil {
+		h.logger.Warn("send message failed", zap.Error(err), zap.Int64("chat_id", chatID))
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeConfigName(t *testing.T) {
+	cases := map[string]string{
+		"client-eu":        "client-eu.json",
+		" client_eu.JSON ": "client_eu.JSON",
+		"de.1.json":        "de.1.json",
+	}
+	for input, want := range cases {
+		got, err := normalizeConfigName(input)
+		if err != nil || got != want {
+			t.Fatalf("normalizeConfigName(%q) = %q, %v, want %q", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"", "../etc/passwd", "a/b", ".hidden", "config", "with space", "<b>", strings.Repeat("a", 70)} {
+		if got, err := normalizeConfigName(input); err == nil {
+			t.Fatalf("normalizeConfigName(%q) = %q, expected an error", input, got)
+		}
+	}
+}
+
+func TestFetchURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bot123:secret/config.json":
+			_, _ = w.Write([]byte(`{"outbounds": []}`))
+		case "/bot123:secret/large.json":
+			_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	data, err := fetchURL(context.Background(), server.Client(), server.URL+"/bot123:secret/config.json", 64)
+	if err != nil || string(data) != `{"outbounds": []}` {
+		t.Fatalf("fetchURL = %q, %v", data, err)
+	}
+
+	if _, err := fetchURL(context.Background(), server.Client(), server.URL+"/bot123:secret/large.json", 64); !errors.Is(err, errUploadTooLarge) {
+		t.Fatalf("expected errUploadTooLarge, got %v", err)
+	}
+
+	_, err = fetchURL(context.Background(), server.Client(), server.URL+"/bot123:secret/missing.json", 64)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Fatalf("expected an error without the url, got %v", err)
+	}
+
+	server.Close()
+	_, err = fetchURL(context.Background(), server.Client(), server.URL+"/bot123:secret/config.json", 64)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Fatalf("expected an error without the url, got %v", err)
+	}
+}
+
+func TestWriteConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "client.json"), "old")
+
+	if err := writeConfigFile(dir, "client.json", []byte("new")); err != nil {
+		t.Fatalf("writeConfigFile returned error: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "client.json"))
+	if err != nil || string(data) != "new" {
+		t.Fatalf("config content = %q, %v", data, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected only the config to remain, got %v, %v", entries, err)
+	}
+}
+
+func TestValidateUpload(t *testing.T) {
+	h := &Handler{}
+
+	if _, err := h.validateUpload(context.Background(), "ok.json", []byte(`{"inbounds": [], "outbounds": [{"protocol": "freedom"}]}`)); err != nil {
+		t.Fatalf("validateUpload rejected a valid config: %v", err)
+	}
+
+	text, err := h.validateUpload(context.Background(), "bad.json", []byte(`{"inbounds": []}`))
+	if err == nil {
+		t.Fatal("validateUpload accepted a config without outbounds")
+	}
+	if !strings.Contains(text, "<code>bad.json</code> was not saved") {
+		t.Fatalf("unexpected rejection text: %s", text)
+	}
+}
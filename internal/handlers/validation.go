@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/audit"
+	"github.com/bonus2k/xray-tlg/internal/xrayconfig"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	maxShownProblems = 15
+
+	// ValidatorConfigPlaceholder is replaced with the candidate config path in
+	// the validator command; without it the path is appended as the last argument.
+	ValidatorConfigPlaceholder = "{config}"
+	defaultValidatorTimeout    = 30 * time.Second
+	maxValidatorOutputLength   = 3000
+)
+
+type validatorError struct {
+	output string
+	err    error
+}
+
+func (e *validatorError) Error() string {
+	if e.output == "" {
+		return fmt.Sprintf("config validator failed: %v", e.err)
+	}
+	return fmt.Sprintf("config validator failed: %v: %s", e.err, e.output)
+}
+
+func (e *validatorError) Unwrap() error {
+	return e.err
+}
+
+func WithValidator(command []string, timeout time.Duration) Option {
+	return func(h *Handler) {
+		if timeout <= 0 {
+			timeout = defaultValidatorTimeout
+		}
+		h.validatorCommand = command
+		h.validatorTimeout = timeout
+	}
+}
+
+func validateConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config for validation: %w", err)
+	}
+	return xrayconfig.Validate(data)
+}
+
+// configChecks returns the checks run against a candidate config before it
+// replaces the active one.
+func (h *Handler) configChecks(ctx context.Context) []func(path string) error {
+	checks := []func(path string) error{validateConfigFile}
+	if len(h.validatorCommand) > 0 {
+		checks = append(checks, func(path string) error {
+			return h.runValidator(ctx, path)
+		})
+	}
+	return checks
+}
+
+func (h *Handler) runValidator(ctx context.Context, path string) error {
+	ctx, cancel := context.WithTimeout(ctx, h.validatorTimeout)
+	defer cancel()
+
+	args := validatorArgs(h.validatorCommand, path)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+		// A missing binary says nothing about the config, so it is reported
+		// as a setup problem rather than a rejection.
+		return fmt.Errorf("config validator %q is not installed, set validator_command to its full path or to none: %w", args[0], err)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", h.validatorTimeout)
+	}
+
+	// xray prints most of its diagnostics to stdout, so fall back to it when
+	// stderr is empty.
+	output := strings.TrimSpace(stderr.String())
+	if output == "" {
+		output = strings.TrimSpace(stdout.String())
+	}
+	return &validatorError{output: output, err: err}
+}
+
+func validatorArgs(command []string, path string) []string {
+	args := make([]string, 0, len(command)+1)
+	replaced := false
+	for _, arg := range command {
+		if strings.Contains(arg, ValidatorConfigPlaceholder) {
+			arg = strings.ReplaceAll(arg, ValidatorConfigPlaceholder, path)
+			replaced = true
+		}
+		args = append(args, arg)
+	}
+	if !replaced {
+		args = append(args, path)
+	}
+	return args
+}
+
+func (h *Handler) rejectInvalidConfig(ctx context.Context, b *bot.Bot, req callbackRequest, text string) error {
+	req.markOutcome(audit.OutcomeRejected)
+	if _, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      req.chatID,
+		MessageID:   req.messageID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: h.mainMenuKeyboard(req.role),
+	}); err != nil {
+		return fmt.Errorf("set invalid config message: %w", err)
+	}
+	return nil
+}
+
+func formatValidationProblems(fileName, verb string, problems []string) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "❌ Config <code>%s</code> was not %s:\n", html.EscapeString(fileName), verb)
+	for i, problem := range problems {
+		if i == maxShownProblems {
+			fmt.Fprintf(&builder, "… and %d more\n", len(problems)-maxShownProblems)
+			break
+		}
+		fmt.Fprintf(&builder, "• %s\n", html.EscapeString(problem))
+	}
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+func formatValidatorFailure(fileName string, err *validatorError) string {
+	text := fmt.Sprintf("❌ Config <code>%s</code> was rejected by the validator: %s",
+		html.EscapeString(fileName), html.EscapeString(err.err.Error()))
+	if err.output != "" {
+		text += fmt.Sprintf("\n<pre>%s</pre>", html.EscapeString(tailText(err.output, maxValidatorOutputLength)))
+	}
+	return text
+}
+
+// tailText keeps the end of the output, where validators print the actual
+// error after any banners.
+func tailText(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+	return "…" + string(runes[len(runes)-limit:])
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFakeValidator(t *testing.T, script string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "fake-xray")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatalf("write fake validator failed: %v", err)
+	}
+	return path
+}
+
+func TestValidatorArgs(t *testing.T) {
+	got := validatorArgs([]string{"xray", "run", "-test", "-config", ValidatorConfigPlaceholder}, "/tmp/c.json")
+	want := []string{"xray", "run", "-test", "-config", "/tmp/c.json"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("validatorArgs = %v, want %v", got, want)
+	}
+
+	got = validatorArgs([]string{"check"}, "/tmp/c.json")
+	if !reflect.DeepEqual(got, []string{"check", "/tmp/c.json"}) {
+		t.Fatalf("expected path to be appended, got %v", got)
+	}
+}
+
+func TestRunValidator(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.json.tmp")
+	writeTestFile(t, config, `{}`)
+
+	h := &Handler{validatorTimeout: time.Second}
+
+	h.validatorCommand = []string{writeFakeValidator(t, `test "$1" = "-config" && test -f "$2"`), "-config", ValidatorConfigPlaceholder}
+	if err := h.runValidator(context.Background(), config); err != nil {
+		t.Fatalf("runValidator returned error: %v", err)
+	}
+
+	h.validatorCommand = []string{writeFakeValidator(t, `echo "Xray 1.8.0"; echo "failed to load config: bad outbound" >&2; exit 23`)}
+	err := h.runValidator(context.Background(), config)
+	var rejected *validatorError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("expected validatorError, got %v", err)
+	}
+	if rejected.output != "failed to load config: bad outbound" {
+		t.Fatalf("expected stderr to be captured, got %q", rejected.output)
+	}
+	if text := formatValidatorFailure("bad.json", rejected); !strings.Contains(text, "<pre>failed to load config: bad outbound</pre>") {
+		t.Fatalf("unexpected failure text: %s", text)
+	}
+}
+
+func TestRunValidatorReportsMissingBinary(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.json")
+	writeTestFile(t, config, `{}`)
+
+	h := &Handler{validatorTimeout: time.Second}
+	for _, name := range []string{"xray-tlg-missing-validator", filepath.Join(t.TempDir(), "xray")} {
+		h.validatorCommand = []string{name, "-config", ValidatorConfigPlaceholder}
+		err := h.runValidator(context.Background(), config)
+		var rejected *validatorError
+		if err == nil || errors.As(err, &rejected) {
+			t.Fatalf("expected a setup error for %s, got %v", name, err)
+		}
+		if !strings.Contains(err.Error(), "validator_command") {
+			t.Fatalf("expected the error to point at validator_command, got %v", err)
+		}
+	}
+}
+
+func TestCopyConfigFileRunsValidatorOnTempFile(t *testing.T) {
+	dir := t.TempDir()
+	sourcePath := filepath.Join(dir, "client.json")
+	destinationPath := filepath.Join(dir, "config.json")
+	argsPath := filepath.Join(t.TempDir(), "args")
+	writeTestFile(t, sourcePath, `{"inbounds": [], "outbounds": [{"protocol": "freedom"}]}`)
+	writeTestFile(t, destinationPath, `{"active": true}`)
+
+	h := &Handler{
+		validatorCommand: []string{writeFakeValidator(t, `echo "$1" > `+argsPath+`; exit 1`)},
+		validatorTimeout: time.Second,
+	}
+	if err := copyConfigFile(sourcePath, destinationPath, h.configChecks(context.Background())...); err == nil {
+		t.Fatalf("expected validator to reject the temp file")
+	}
+
+	data, err := os.ReadFile(destinationPath)
+	if err != nil {
+		t.Fatalf("read destination file failed: %v", err)
+	}
+	if string(data) != `{"active": true}` {
+		t.Fatalf("destination was overwritten: %s", data)
+	}
+
+	args, err := os.ReadFile(argsPath)
+	if err != nil {
+		t.Fatalf("validator did not run: %v", err)
+	}
+	validated := strings.TrimSpace(string(args))
+	if validated == destinationPath || filepath.Dir(validated) != dir || !strings.HasSuffix(validated, ".json") {
+		t.Fatalf("validator got %q, want a .json temp file next to the destination", validated)
+	}
+	if _, err := os.Stat(validated); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("rejected temp file was left behind: %v", err)
+	}
+}
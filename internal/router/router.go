@@ -7,11 +7,30 @@ import (
 
 func GetRouter(h *handlers.Handler) []bot.Option {
 	return []bot.Option{
+		bot.WithMiddlewares(h.Middlewares()...),
 		bot.WithDefaultHandler(h.DefaultHandler),
-		bot.WithCallbackQueryDataHandler("speedtest", bot.MatchTypePrefix, h.SpeedtestHandler),
-		bot.WithCallbackQueryDataHandler("ls_config", bot.MatchTypePrefix, h.ListConfigXrayHandler),
-		bot.WithCallbackQueryDataHandler("main", bot.MatchTypePrefix, h.MainHandler),
-		bot.WithCallbackQueryDataHandler("cp_", bot.MatchTypePrefix, h.CopyConfigXrayHandler),
-		bot.WithCallbackQueryDataHandler("restart", bot.MatchTypePrefix, h.RestartXrayHandler),
+		bot.WithMessageTextHandler("totp", bot.MatchTypeCommandStartOnly, h.TOTPEnrollHandler),
+		bot.WithMessageTextHandler("audit", bot.MatchTypeCommandStartOnly, h.AuditHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackSpeedtest), bot.MatchTypePrefix, h.SpeedtestHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackListConfigs), bot.MatchTypePrefix, h.ListConfigXrayHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackMainMenu), bot.MatchTypePrefix, h.MainHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackCopyConfig), bot.MatchTypePrefix, h.CopyConfigXrayHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackCopyConfirm), bot.MatchTypePrefix, h.ConfirmCopyConfigXrayHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackRestart), bot.MatchTypePrefix, h.RestartXrayHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackRestartConfirm), bot.MatchTypePrefix, h.ConfirmRestartXrayHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackAuditPage), bot.MatchTypePrefix, h.AuditPageHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackBackups), bot.MatchTypePrefix, h.BackupsHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackRollback), bot.MatchTypePrefix, h.RollbackHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackRollbackConfirm), bot.MatchTypePrefix, h.ConfirmRollbackHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackDiff), bot.MatchTypePrefix, h.DiffConfigHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackUploadOverwrite), bot.MatchTypePrefix, h.ConfirmUploadOverwriteHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackUploadCancel), bot.MatchTypePrefix, h.CancelUploadHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackExport), bot.MatchTypePrefix, h.ExportConfigHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackExportSend), bot.MatchTypePrefix, h.SendExportHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackManageConfigs), bot.MatchTypePrefix, h.ManageConfigsHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackRenameConfig), bot.MatchTypePrefix, h.RenameConfigHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackDeleteConfig), bot.MatchTypePrefix, h.DeleteConfigHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackDeleteConfirm), bot.MatchTypePrefix, h.ConfirmDeleteConfigHandler),
+		bot.WithCallbackQueryDataHandler(handlers.CallbackPrefix(handlers.CallbackSubscriptions), bot.MatchTypePrefix, h.RefreshSubscriptionsHandler),
 	}
 }
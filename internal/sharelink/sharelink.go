@@ -0,0 +1,530 @@
+// Package sharelink turns vless://, vmess://, trojan:// and ss:// share links
+// into Xray client configs.
+package sharelink
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OutboundTag is the tag of the proxy outbound in rendered configs.
+const OutboundTag = "proxy"
+
+// DefaultTemplate is the base config links are rendered into: a SOCKS
+// inbound on port 1080 plus direct and block outbounds.
+//
+//go:embed template.json
+var DefaultTemplate []byte
+
+var (
+	ErrUnsupportedScheme = errors.New("unsupported share link scheme")
+
+	schemes     = []string{"vless://", "vmess://", "trojan://", "ss://"}
+	slugPattern = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// Link is a parsed share link.
+type Link struct {
+	Name     string
+	Protocol string
+	Address  string
+	Port     int
+	// Outbound is the Xray outbound object for the server.
+	Outbound map[string]any
+}
+
+// Find returns every share link in text, in order.
+func Find(text string) []string {
+	var links []string
+	for _, field := range strings.Fields(text) {
+		if isLink(field) {
+			links = append(links, field)
+		}
+	}
+	return links
+}
+
+func isLink(text string) bool {
+	lower := strings.ToLower(text)
+	for _, scheme := range schemes {
+		if strings.HasPrefix(lower, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse parses a single share link.
+func Parse(raw string) (Link, error) {
+	raw = strings.TrimSpace(raw)
+	scheme, _, _ := strings.Cut(raw, "://")
+	switch strings.ToLower(scheme) {
+	case "vless":
+		return parseVLESS(raw)
+	case "vmess":
+		return parseVMess(raw)
+	case "trojan":
+		return parseTrojan(raw)
+	case "ss":
+		return parseShadowsocks(raw)
+	default:
+		return Link{}, fmt.Errorf("%w: %q", ErrUnsupportedScheme, scheme)
+	}
+}
+
+// Render inserts the link's outbound in front of the template outbounds, so
+// it becomes the default route, and stores the link name in "remarks".
+func Render(template []byte, link Link) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(template))
+	decoder.UseNumber()
+	var config map[string]any
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("decode template: %w", err)
+	}
+
+	var outbounds []any
+	if existing, ok := config["outbounds"]; ok {
+		if outbounds, ok = existing.([]any); !ok {
+			return nil, errors.New(`template "outbounds" must be an array`)
+		}
+	}
+	config["outbounds"] = append([]any{link.Outbound}, outbounds...)
+	if link.Name != "" {
+		config["remarks"] = link.Name
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(config); err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// FileName suggests a config file name for the link: the link name reduced
+// to a safe character set, or protocol-address-port when nothing is left.
+func FileName(link Link) string {
+	name := strings.Trim(slugPattern.ReplaceAllString(link.Name, "-"), "-._")
+	if name == "" {
+		name = strings.Trim(slugPattern.ReplaceAllString(fmt.Sprintf("%s-%s-%d", link.Protocol, link.Address, link.Port), "-"), "-._")
+	}
+	if len(name) > 48 {
+		name = strings.TrimRight(name[:48], "-._")
+	}
+	return name + ".json"
+}
+
+// DecodeBase64 accepts standard and URL-safe base64, with or without
+// padding, as found in share links and subscriptions.
+func DecodeBase64(text string) ([]byte, error) {
+	text = strings.Join(strings.Fields(text), "")
+	for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if data, err := encoding.DecodeString(text); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errors.New("invalid base64")
+}
+
+func parseVLESS(raw string) (Link, error) {
+	u, host, port, err := parseURL(raw)
+	if err != nil {
+		return Link{}, err
+	}
+	id := u.User.Username()
+	if id == "" {
+		return Link{}, errors.New("vless link has no user id")
+	}
+	query := u.Query()
+
+	user := map[string]any{"id": id, "encryption": valueOr(query.Get("encryption"), "none")}
+	if flow := query.Get("flow"); flow != "" {
+		user["flow"] = flow
+	}
+	stream, err := streamSettings(streamParams{
+		network:     query.Get("type"),
+		security:    query.Get("security"),
+		host:        query.Get("host"),
+		path:        query.Get("path"),
+		serviceName: query.Get("serviceName"),
+		grpcMode:    query.Get("mode"),
+		headerType:  query.Get("headerType"),
+		sni:         query.Get("sni"),
+		fingerprint: query.Get("fp"),
+		alpn:        query.Get("alpn"),
+		insecure:    query.Get("allowInsecure"),
+		publicKey:   query.Get("pbk"),
+		shortID:     query.Get("sid"),
+		spiderX:     query.Get("spx"),
+	})
+	if err != nil {
+		return Link{}, err
+	}
+
+	return Link{
+		Name:     u.Fragment,
+		Protocol: "vless",
+		Address:  host,
+		Port:     port,
+		Outbound: outbound("vless", map[string]any{
+			"vnext": []any{map[string]any{"address": host, "port": port, "users": []any{user}}},
+		}, stream),
+	}, nil
+}
+
+func parseTrojan(raw string) (Link, error) {
+	u, host, port, err := parseURL(raw)
+	if err != nil {
+		return Link{}, err
+	}
+	password := u.User.Username()
+	if password == "" {
+		return Link{}, errors.New("trojan link has no password")
+	}
+	query := u.Query()
+
+	server := map[string]any{"address": host, "port": port, "password": password}
+	if flow := query.Get("flow"); flow != "" {
+		server["flow"] = flow
+	}
+	stream, err := streamSettings(streamParams{
+		network:     query.Get("type"),
+		security:    valueOr(query.Get("security"), "tls"),
+		host:        query.Get("host"),
+		path:        query.Get("path"),
+		serviceName: query.Get("serviceName"),
+		grpcMode:    query.Get("mode"),
+		headerType:  query.Get("headerType"),
+		sni:         valueOr(query.Get("sni"), query.Get("peer")),
+		fingerprint: query.Get("fp"),
+		alpn:        query.Get("alpn"),
+		insecure:    query.Get("allowInsecure"),
+		publicKey:   query.Get("pbk"),
+		shortID:     query.Get("sid"),
+		spiderX:     query.Get("spx"),
+	})
+	if err != nil {
+		return Link{}, err
+	}
+
+	return Link{
+		Name:     u.Fragment,
+		Protocol: "trojan",
+		Address:  host,
+		Port:     port,
+		Outbound: outbound("trojan", map[string]any{"servers": []any{server}}, stream),
+	}, nil
+}
+
+// vmessLink is the JSON carried base64-encoded in vmess:// links.
+type vmessLink struct {
+	Name        string      `json:"ps"`
+	Address     string      `json:"add"`
+	Port        looseNumber `json:"port"`
+	ID          string      `json:"id"`
+	AlterID     looseNumber `json:"aid"`
+	Security    string      `json:"scy"`
+	Network     string      `json:"net"`
+	HeaderType  string      `json:"type"`
+	Host        string      `json:"host"`
+	Path        string      `json:"path"`
+	TLS         string      `json:"tls"`
+	SNI         string      `json:"sni"`
+	ALPN        string      `json:"alpn"`
+	Fingerprint string      `json:"fp"`
+}
+
+// looseNumber accepts numbers sent either as JSON numbers or as strings,
+// both of which are common in vmess links.
+type looseNumber string
+
+func (n *looseNumber) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*n = looseNumber(strings.TrimSpace(text))
+		return nil
+	}
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*n = looseNumber(number)
+	return nil
+}
+
+func parseVMess(raw string) (Link, error) {
+	payload := raw[len("vmess://"):]
+	if index := strings.IndexByte(payload, '#'); index >= 0 {
+		payload = payload[:index]
+	}
+	data, err := DecodeBase64(payload)
+	if err != nil {
+		return Link{}, fmt.Errorf("vmess link: %w", err)
+	}
+
+	var v vmessLink
+	if err := json.Unmarshal(data, &v); err != nil {
+		return Link{}, fmt.Errorf("vmess link: %w", err)
+	}
+	if v.Address == "" || v.ID == "" {
+		return Link{}, errors.New("vmess link has no address or id")
+	}
+	port, err := parsePort(string(v.Port))
+	if err != nil {
+		return Link{}, err
+	}
+	alterID := 0
+	if v.AlterID != "" {
+		if alterID, err = strconv.Atoi(string(v.AlterID)); err != nil {
+			return Link{}, fmt.Errorf("vmess link has invalid aid %q", v.AlterID)
+		}
+	}
+
+	params := streamParams{
+		network:     v.Network,
+		security:    v.TLS,
+		host:        v.Host,
+		path:        v.Path,
+		headerType:  v.HeaderType,
+		sni:         v.SNI,
+		fingerprint: v.Fingerprint,
+		alpn:        v.ALPN,
+	}
+	if v.Network == "grpc" {
+		params.serviceName = v.Path
+		params.grpcMode = v.HeaderType
+	}
+	stream, err := streamSettings(params)
+	if err != nil {
+		return Link{}, err
+	}
+
+	return Link{
+		Name:     v.Name,
+		Protocol: "vmess",
+		Address:  v.Address,
+		Port:     port,
+		Outbound: outbound("vmess", map[string]any{
+			"vnext": []any{map[string]any{
+				"address": v.Address,
+				"port":    port,
+				"users":   []any{map[string]any{"id": v.ID, "alterId": alterID, "security": valueOr(v.Security, "auto")}},
+			}},
+		}, stream),
+	}, nil
+}
+
+// parseShadowsocks accepts SIP002 links with base64 or percent-encoded user
+// info, and the legacy form where everything before "#" is base64.
+func parseShadowsocks(raw string) (Link, error) {
+	body, name, _ := strings.Cut(raw[len("ss://"):], "#")
+	if decodedName, err := url.PathUnescape(name); err == nil {
+		name = decodedName
+	}
+	if !strings.Contains(body, "@") {
+		data, err := DecodeBase64(body)
+		if err != nil {
+			return Link{}, fmt.Errorf("ss link: %w", err)
+		}
+		body = string(data)
+	}
+
+	u, host, port, err := parseURL("ss://" + body)
+	if err != nil {
+		return Link{}, err
+	}
+	if u.Query().Get("plugin") != "" {
+		return Link{}, errors.New("ss plugins are not supported")
+	}
+
+	method, password := u.User.Username(), ""
+	if p, ok := u.User.Password(); ok {
+		password = p
+	} else if data, err := DecodeBase64(method); err == nil {
+		method, password, _ = strings.Cut(string(data), ":")
+	}
+	if method == "" || password == "" {
+		return Link{}, errors.New("ss link has no method or password")
+	}
+
+	return Link{
+		Name:     name,
+		Protocol: "shadowsocks",
+		Address:  host,
+		Port:     port,
+		Outbound: outbound("shadowsocks", map[string]any{
+			"servers": []any{map[string]any{"address": host, "port": port, "method": method, "password": password}},
+		}, nil),
+	}, nil
+}
+
+func parseURL(raw string) (*url.URL, string, int, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		// url.Error repeats the whole link, secrets included.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, "", 0, fmt.Errorf("invalid link: %w", err)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return nil, "", 0, errors.New("link has no server address")
+	}
+	port, err := parsePort(u.Port())
+	if err != nil {
+		return nil, "", 0, err
+	}
+	return u, host, port, nil
+}
+
+func parsePort(text string) (int, error) {
+	port, err := strconv.Atoi(text)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", text)
+	}
+	return port, nil
+}
+
+type streamParams struct {
+	network     string
+	security    string
+	host        string
+	path        string
+	serviceName string
+	grpcMode    string
+	headerType  string
+	sni         string
+	fingerprint string
+	alpn        string
+	insecure    string
+	publicKey   string
+	shortID     string
+	spiderX     string
+}
+
+func streamSettings(p streamParams) (map[string]any, error) {
+	network := strings.ToLower(valueOr(p.network, "tcp"))
+	stream := map[string]any{}
+
+	switch network {
+	case "tcp", "raw":
+		network = "tcp"
+		if p.headerType == "http" {
+			request := map[string]any{"path": []any{valueOr(p.path, "/")}}
+			if hosts := splitList(p.host); len(hosts) > 0 {
+				request["headers"] = map[string]any{"Host": hosts}
+			}
+			stream["tcpSettings"] = map[string]any{"header": map[string]any{"type": "http", "request": request}}
+		}
+	case "ws":
+		ws := map[string]any{"path": valueOr(p.path, "/")}
+		if p.host != "" {
+			ws["headers"] = map[string]any{"Host": p.host}
+		}
+		stream["wsSettings"] = ws
+	case "grpc":
+		grpc := map[string]any{"serviceName": p.serviceName}
+		if p.grpcMode == "multi" {
+			grpc["multiMode"] = true
+		}
+		stream["grpcSettings"] = grpc
+	case "h2", "http":
+		network = "http"
+		h2 := map[string]any{"path": valueOr(p.path, "/")}
+		if hosts := splitList(p.host); len(hosts) > 0 {
+			h2["host"] = hosts
+		}
+		stream["httpSettings"] = h2
+	default:
+		return nil, fmt.Errorf("unsupported transport %q", p.network)
+	}
+	stream["network"] = network
+
+	switch security := strings.ToLower(p.security); security {
+	case "", "none":
+		stream["security"] = "none"
+	case "tls", "xtls":
+		tls := map[string]any{}
+		if p.sni != "" {
+			tls["serverName"] = p.sni
+		} else if host := firstHost(p.host); host != "" {
+			tls["serverName"] = host
+		}
+		if p.fingerprint != "" {
+			tls["fingerprint"] = p.fingerprint
+		}
+		if alpn := splitList(p.alpn); len(alpn) > 0 {
+			tls["alpn"] = alpn
+		}
+		if p.insecure == "1" || strings.EqualFold(p.insecure, "true") {
+			tls["allowInsecure"] = true
+		}
+		stream["security"] = "tls"
+		stream["tlsSettings"] = tls
+	case "reality":
+		if p.publicKey == "" {
+			return nil, errors.New("reality link has no public key (pbk)")
+		}
+		reality := map[string]any{
+			"serverName":  p.sni,
+			"fingerprint": valueOr(p.fingerprint, "chrome"),
+			"publicKey":   p.publicKey,
+			"shortId":     p.shortID,
+		}
+		if p.spiderX != "" {
+			reality["spiderX"] = p.spiderX
+		}
+		stream["security"] = "reality"
+		stream["realitySettings"] = reality
+	default:
+		return nil, fmt.Errorf("unsupported security %q", p.security)
+	}
+	return stream, nil
+}
+
+func outbound(protocol string, settings, stream map[string]any) map[string]any {
+	result := map[string]any{"tag": OutboundTag, "protocol": protocol, "settings": settings}
+	if stream != nil {
+		result["streamSettings"] = stream
+	}
+	return result
+}
+
+func splitList(text string) []any {
+	var items []any
+	for _, item := range strings.Split(text, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func firstHost(hosts string) string {
+	host, _, _ := strings.Cut(hosts, ",")
+	host = strings.TrimSpace(host)
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	return host
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
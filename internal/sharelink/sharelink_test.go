@@ -0,0 +1,236 @@
+package sharelink
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/bonus2k/xray-tlg/internal/xrayconfig"
+)
+
+func TestParseVLESSReality(t *testing.T) {
+	link, err := Parse("vless://b831381d-6324-4d53-ad4f-8cda48b30811@de.example.com:443?encryption=none&flow=xtls-rprx-vision&security=reality&sni=www.microsoft.com&fp=chrome&pbk=SbVKOEMjK0sIlbwg4akyBg5mL5KZwwB-ed4eEE7YnRc&sid=6ba85179e30d4fc2&type=tcp#DE%20Reality")
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if link.Name != "DE Reality" || link.Protocol != "vless" || link.Address != "de.example.com" || link.Port != 443 {
+		t.Fatalf("unexpected link: %+v", link)
+	}
+
+	user := path(t, link.Outbound, "settings", "vnext", 0, "users", 0).(map[string]any)
+	if user["id"] != "b831381d-6324-4d53-ad4f-8cda48b30811" || user["flow"] != "xtls-rprx-vision" || user["encryption"] != "none" {
+		t.Fatalf("unexpected user: %v", user)
+	}
+	reality := path(t, link.Outbound, "streamSettings", "realitySettings").(map[string]any)
+	if reality["serverName"] != "www.microsoft.com" || reality["shortId"] != "6ba85179e30d4fc2" || reality["publicKey"] == "" {
+		t.Fatalf("unexpected reality settings: %v", reality)
+	}
+	if security := path(t, link.Outbound, "streamSettings", "security"); security != "reality" {
+		t.Fatalf("unexpected security: %v", security)
+	}
+}
+
+func TestParseTransports(t *testing.T) {
+	cases := map[string]struct {
+		link     string
+		network  string
+		settings string
+		key      string
+		want     any
+	}{
+		"vless ws tls": {
+			link:     "vless://id@[2001:db8::1]:8443?security=tls&sni=cdn.example.com&type=ws&path=%2Fray&host=cdn.example.com&alpn=h2,http/1.1",
+			network:  "ws",
+			settings: "wsSettings",
+			key:      "path",
+			want:     "/ray",
+		},
+		"vless grpc": {
+			link:     "vless://id@grpc.example.com:443?security=tls&type=grpc&serviceName=tun&mode=multi",
+			network:  "grpc",
+			settings: "grpcSettings",
+			key:      "multiMode",
+			want:     true,
+		},
+		"trojan h2": {
+			link:     "trojan://secret@h2.example.com:443?type=h2&path=%2Fh2&host=h2.example.com",
+			network:  "http",
+			settings: "httpSettings",
+			key:      "path",
+			want:     "/h2",
+		},
+	}
+
+	for name, tc := range cases {
+		link, err := Parse(tc.link)
+		if err != nil {
+			t.Fatalf("%s: Parse returned error: %v", name, err)
+		}
+		if network := path(t, link.Outbound, "streamSettings", "network"); network != tc.network {
+			t.Fatalf("%s: network = %v, want %s", name, network, tc.network)
+		}
+		if got := path(t, link.Outbound, "streamSettings", tc.settings, tc.key); got != tc.want {
+			t.Fatalf("%s: %s.%s = %v, want %v", name, tc.settings, tc.key, got, tc.want)
+		}
+		if security := path(t, link.Outbound, "streamSettings", "security"); security != "tls" {
+			t.Fatalf("%s: security = %v, want tls", name, security)
+		}
+	}
+}
+
+func TestParseVLESSIPv6Address(t *testing.T) {
+	link, err := Parse("vless://id@[2001:db8::1]:8443?security=tls&sni=cdn.example.com")
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if link.Address != "2001:db8::1" || link.Port != 8443 {
+		t.Fatalf("unexpected address: %s:%d", link.Address, link.Port)
+	}
+}
+
+func TestParseVMess(t *testing.T) {
+	payload := `{"v":"2","ps":"US vmess","add":"us.example.com","port":"443","id":"uuid-1","aid":"0","scy":"auto","net":"ws","type":"none","host":"us.example.com","path":"/vm","tls":"tls","sni":"us.example.com"}`
+	link, err := Parse("vmess://" + base64.StdEncoding.EncodeToString([]byte(payload)))
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	if link.Name != "US vmess" || link.Port != 443 {
+		t.Fatalf("unexpected link: %+v", link)
+	}
+	if id := path(t, link.Outbound, "settings", "vnext", 0, "users", 0, "id"); id != "uuid-1" {
+		t.Fatalf("unexpected id: %v", id)
+	}
+	if host := path(t, link.Outbound, "streamSettings", "wsSettings", "headers", "Host"); host != "us.example.com" {
+		t.Fatalf("unexpected ws host: %v", host)
+	}
+
+	numeric := `{"ps":"n","add":"1.2.3.4","port":10086,"id":"uuid-2","aid":0,"net":"grpc","path":"svc","tls":""}`
+	link, err = Parse("vmess://" + base64.RawURLEncoding.EncodeToString([]byte(numeric)))
+	if err != nil {
+		t.Fatalf("Parse returned error for numeric fields: %v", err)
+	}
+	if service := path(t, link.Outbound, "streamSettings", "grpcSettings", "serviceName"); service != "svc" {
+		t.Fatalf("unexpected grpc service: %v", service)
+	}
+}
+
+func TestParseShadowsocks(t *testing.T) {
+	userInfo := base64.RawURLEncoding.EncodeToString([]byte("chacha20-ietf-poly1305:pa:ss"))
+	legacy := base64.StdEncoding.EncodeToString([]byte("aes-256-gcm:secret@ss.example.com:8388"))
+
+	cases := map[string]struct {
+		link     string
+		method   string
+		password string
+	}{
+		"sip002": {"ss://" + userInfo + "@ss.example.com:8388#SS%20one", "chacha20-ietf-poly1305", "pa:ss"},
+		"plain":  {"ss://2022-blake3-aes-128-gcm:a2V5@ss.example.com:8388#SS", "2022-blake3-aes-128-gcm", "a2V5"},
+		"legacy": {"ss://" + legacy + "#Legacy", "aes-256-gcm", "secret"},
+	}
+	for name, tc := range cases {
+		link, err := Parse(tc.link)
+		if err != nil {
+			t.Fatalf("%s: Parse returned error: %v", name, err)
+		}
+		server := path(t, link.Outbound, "settings", "servers", 0).(map[string]any)
+		if server["method"] != tc.method || server["password"] != tc.password || server["address"] != "ss.example.com" || link.Port != 8388 {
+			t.Fatalf("%s: unexpected server: %v", name, server)
+		}
+	}
+}
+
+func TestParseRejectsBadLinks(t *testing.T) {
+	for _, raw := range []string{
+		"http://example.com",
+		"vless://@example.com:443",
+		"vless://id@example.com",
+		"vless://id@example.com:443?security=reality",
+		"vless://id@example.com:443?type=kcp2",
+		"trojan://pw@example.com:70000",
+		"vmess://not-base64!",
+		"ss://YWVzLTI1Ni1nY206c2VjcmV0@example.com:8388?plugin=obfs-local",
+	} {
+		if _, err := Parse(raw); err == nil {
+			t.Fatalf("Parse(%q) accepted a bad link", raw)
+		}
+	}
+}
+
+func TestParseErrorsHideLink(t *testing.T) {
+	_, err := Parse("trojan://super-secret@exa mple.com:443")
+	if err == nil || strings.Contains(err.Error(), "super-secret") {
+		t.Fatalf("expected an error without the password, got %v", err)
+	}
+}
+
+func TestRenderProducesValidConfig(t *testing.T) {
+	link, err := Parse("trojan://secret@tr.example.com:443?sni=tr.example.com#Trojan")
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+	data, err := Render(DefaultTemplate, link)
+	if err != nil {
+		t.Fatalf("Render returned error: %v", err)
+	}
+	if err := xrayconfig.Validate(data); err != nil {
+		t.Fatalf("rendered config is invalid: %v\n%s", err, data)
+	}
+
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("decode rendered config: %v", err)
+	}
+	if config["remarks"] != "Trojan" {
+		t.Fatalf("unexpected remarks: %v", config["remarks"])
+	}
+	if tag := path(t, config, "outbounds", 0, "tag"); tag != OutboundTag {
+		t.Fatalf("proxy outbound must come first, got %v", tag)
+	}
+	if port := path(t, config, "inbounds", 0, "port"); port != float64(1080) {
+		t.Fatalf("unexpected socks port: %v", port)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	cases := map[string]Link{
+		"DE-Reality.json":                  {Name: "DE / Reality"},
+		"vless-1.2.3.4-443.json":           {Name: "🇩🇪", Protocol: "vless", Address: "1.2.3.4", Port: 443},
+		"shadowsocks-2001-db8-1-8388.json": {Protocol: "shadowsocks", Address: "2001:db8::1", Port: 8388},
+	}
+	for want, link := range cases {
+		if got := FileName(link); got != want {
+			t.Fatalf("FileName(%+v) = %q, want %q", link, got, want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	links := Find("here you go:\nvless://a@b:1#x\n\nVMESS://abc trojan://c@d:2 https://example.com ss://e@f:3")
+	if len(links) != 4 || links[1] != "VMESS://abc" {
+		t.Fatalf("unexpected links: %q", links)
+	}
+}
+
+// path walks decoded JSON by object keys and array indexes.
+func path(t *testing.T, value any, keys ...any) any {
+	t.Helper()
+
+	for _, key := range keys {
+		switch k := key.(type) {
+		case string:
+			object, ok := value.(map[string]any)
+			if !ok {
+				t.Fatalf("expected an object at %q, got %T", k, value)
+			}
+			value = object[k]
+		case int:
+			array, ok := value.([]any)
+			if !ok || k >= len(array) {
+				t.Fatalf("expected an array with index %d, got %v", k, value)
+			}
+			value = array[k]
+		}
+	}
+	return value
+}
@@ -0,0 +1,362 @@
+// Package subscription keeps a directory of Xray client configs in sync with
+// a subscription URL that serves base64-encoded share links.
+package subscription
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bonus2k/xray-tlg/internal/sharelink"
+	"github.com/bonus2k/xray-tlg/internal/xrayconfig"
+)
+
+const (
+	DefaultInterval = 6 * time.Hour
+	// MaxSize bounds the subscription body; real ones are a few kilobytes.
+	MaxSize        = 5 << 20
+	defaultTimeout = 30 * time.Second
+	dirMode        = 0o750
+	fileMode       = 0o640
+	// manifestName lists the files a refresh wrote, so later refreshes only
+	// remove those and never a profile the user added or renamed.
+	manifestName = ".subscription"
+	metaSuffix   = ".meta"
+)
+
+// ErrNoServers is returned when a subscription yields no usable server. The
+// existing configs are kept, so a provider outage does not wipe them.
+var ErrNoServers = errors.New("subscription has no usable servers")
+
+// Source is a subscription whose servers are written into the subdirectory
+// Name of the configs dir.
+type Source struct {
+	Name     string
+	URL      string
+	Interval time.Duration
+}
+
+// Report describes what a refresh changed. Names are file names inside the
+// subscription directory.
+type Report struct {
+	Source    string
+	Added     []string
+	Removed   []string
+	Updated   []string
+	Unchanged int
+	// Skipped holds one reason per link that could not be turned into a config.
+	Skipped []string
+}
+
+// Changed reports whether the refresh touched any file.
+func (r Report) Changed() bool {
+	return len(r.Added) > 0 || len(r.Removed) > 0 || len(r.Updated) > 0
+}
+
+// Manager refreshes subscriptions into dir. Refreshes are serialized, so a
+// scheduled run and a manual one never write the same directory at once.
+type Manager struct {
+	mutex    sync.Mutex
+	dir      string
+	sources  []Source
+	client   *http.Client
+	template []byte
+}
+
+func New(dir string, sources []Source) *Manager {
+	return &Manager{
+		dir:      dir,
+		sources:  sources,
+		client:   &http.Client{Timeout: defaultTimeout},
+		template: sharelink.DefaultTemplate,
+	}
+}
+
+func (m *Manager) Sources() []Source {
+	return m.sources
+}
+
+// Run refreshes every source right away and then on its interval until ctx
+// is done. report is called after each refresh.
+func (m *Manager) Run(ctx context.Context, report func(Report, error)) {
+	var wg sync.WaitGroup
+	for _, source := range m.sources {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.schedule(ctx, source, report)
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *Manager) schedule(ctx context.Context, source Source, report func(Report, error)) {
+	interval := source.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := m.Refresh(ctx, source)
+		if ctx.Err() != nil {
+			return
+		}
+		report(result, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh downloads the subscription and rewrites its directory: new servers
+// are added, changed ones rewritten and missing ones removed together with
+// their sidecars. Files whose content did not change are left alone, and
+// files the subscription did not write are never touched.
+func (m *Manager) Refresh(ctx context.Context, source Source) (Report, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	report := Report{Source: source.Name}
+	body, err := m.fetch(ctx, source.URL)
+	if err != nil {
+		return report, err
+	}
+
+	configs, skipped := m.render(body)
+	report.Skipped = skipped
+	if len(configs) == 0 {
+		return report, ErrNoServers
+	}
+
+	dir := filepath.Join(m.dir, source.Name)
+	if err := os.MkdirAll(dir, dirMode); err != nil {
+		return report, fmt.Errorf("create subscription dir: %w", err)
+	}
+	managed, found, err := readManifest(dir)
+	if err != nil {
+		return report, err
+	}
+	isManaged := make(map[string]bool, len(managed))
+	for _, name := range managed {
+		isManaged[name] = true
+	}
+
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	written := make([]string, 0, len(names))
+	isWritten := make(map[string]bool, len(names))
+	for _, name := range names {
+		data := configs[name]
+		old, err := os.ReadFile(filepath.Join(dir, name))
+		unchanged := err == nil && bytes.Equal(old, data)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			report.Added = append(report.Added, name)
+		case err != nil:
+			return report, fmt.Errorf("read subscription config: %w", err)
+		case !isManaged[name] && (found || !unchanged):
+			// Without a manifest, files from before it existed are adopted
+			// only when they hold exactly what the subscription would write.
+			report.Skipped = append(report.Skipped, fmt.Sprintf("%s: a file the subscription did not write has this name", name))
+			continue
+		case unchanged:
+			report.Unchanged++
+		default:
+			report.Updated = append(report.Updated, name)
+		}
+		written = append(written, name)
+		isWritten[name] = true
+		if unchanged {
+			continue
+		}
+		if err := writeFile(dir, name, data); err != nil {
+			return report, err
+		}
+	}
+
+	for _, name := range managed {
+		if isWritten[name] {
+			continue
+		}
+		removed, err := removeConfig(dir, name)
+		if err != nil {
+			return report, err
+		}
+		if removed {
+			report.Removed = append(report.Removed, name)
+		}
+	}
+	if err := writeManifest(dir, written); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// fetch keeps the URL out of its errors: subscription URLs usually carry a
+// personal token.
+func (m *Manager) fetch(ctx context.Context, link string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, errors.New("invalid subscription url")
+	}
+	response, err := m.client.Do(request)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("download subscription: %w", err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download subscription: %s", response.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read subscription: %w", err)
+	}
+	if len(data) > MaxSize {
+		return nil, fmt.Errorf("subscription is larger than %d bytes", MaxSize)
+	}
+	return data, nil
+}
+
+// render turns the subscription body into configs keyed by file name.
+// Servers that render to the same config are kept once; different servers
+// sharing a name get -2, -3 suffixes in subscription order.
+func (m *Manager) render(body []byte) (map[string][]byte, []string) {
+	text := string(body)
+	if !strings.Contains(text, "://") {
+		if decoded, err := sharelink.DecodeBase64(text); err == nil {
+			text = string(decoded)
+		}
+	}
+
+	configs := make(map[string][]byte)
+	var skipped []string
+	for i, raw := range sharelink.Find(text) {
+		link, err := sharelink.Parse(raw)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("link %d: %v", i+1, err))
+			continue
+		}
+		data, err := sharelink.Render(m.template, link)
+		if err == nil {
+			err = xrayconfig.Validate(data)
+		}
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("link %d: %v", i+1, err))
+			continue
+		}
+
+		name := sharelink.FileName(link)
+		base := strings.TrimSuffix(name, ".json")
+		for n := 2; ; n++ {
+			old, taken := configs[name]
+			if !taken {
+				configs[name] = data
+				break
+			}
+			if bytes.Equal(old, data) {
+				break
+			}
+			name = fmt.Sprintf("%s-%d.json", base, n)
+		}
+	}
+	return configs, skipped
+}
+
+// readManifest returns the files the last refresh wrote and whether the
+// manifest exists. A directory without one has no managed files, so nothing
+// in it is removed or overwritten.
+func readManifest(dir string) ([]string, bool, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("read subscription manifest: %w", err)
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, false, fmt.Errorf("decode subscription manifest: %w", err)
+	}
+	return names, true, nil
+}
+
+func writeManifest(dir string, names []string) error {
+	data, err := json.Marshal(names)
+	if err != nil {
+		return fmt.Errorf("encode subscription manifest: %w", err)
+	}
+	return writeFile(dir, manifestName, data)
+}
+
+// removeConfig deletes a managed config and its sidecar. Names come from the
+// manifest, so anything that is not a plain file name is ignored.
+func removeConfig(dir, name string) (bool, error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".") {
+		return false, nil
+	}
+	err := os.Remove(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("remove subscription config: %w", err)
+	}
+	meta := strings.TrimSuffix(name, ".json") + metaSuffix
+	if err := os.Remove(filepath.Join(dir, meta)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return true, fmt.Errorf("remove subscription config meta: %w", err)
+	}
+	return true, nil
+}
+
+func writeFile(dir, name string, data []byte) error {
+	file, err := os.CreateTemp(dir, ".subscription-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create subscription temp file: %w", err)
+	}
+	tempPath := file.Name()
+	if _, err := file.Write(data); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("write subscription config: %w", err)
+	}
+	if err := file.Chmod(fileMode); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("chmod subscription config: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("close subscription config: %w", err)
+	}
+	if err := os.Rename(tempPath, filepath.Join(dir, name)); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("save subscription config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package subscription
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type feed struct {
+	mutex  sync.Mutex
+	status int
+	body   string
+}
+
+func (f *feed) set(status int, links ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.status = status
+	f.body = base64.StdEncoding.EncodeToString([]byte(strings.Join(links, "\n")))
+}
+
+func (f *feed) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	w.WriteHeader(f.status)
+	_, _ = w.Write([]byte(f.body))
+}
+
+func TestRefresh(t *testing.T) {
+	const (
+		de      = "trojan://secret@de.example.com:443?sni=de.example.com#DE"
+		deOther = "trojan://secret@de2.example.com:443?sni=de2.example.com#DE"
+		nl      = "vless://id@nl.example.com:443?security=tls&sni=nl.example.com#NL"
+	)
+	f := &feed{}
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	dir := t.TempDir()
+	manager := New(dir, nil)
+	source := Source{Name: "provider", URL: server.URL + "/sub?token=secret-token"}
+	subDir := filepath.Join(dir, "provider")
+
+	f.set(http.StatusOK, de, de, deOther, nl, "vless://broken", "ss://YWVzLTI1Ni1nY206c2VjcmV0@example.com:8388?plugin=obfs-local")
+	report, err := manager.Refresh(context.Background(), source)
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if !slices.Equal(report.Added, []string{"DE-2.json", "DE.json", "NL.json"}) || len(report.Removed) != 0 || len(report.Updated) != 0 {
+		t.Fatalf("unexpected first report: %+v", report)
+	}
+	if len(report.Skipped) != 2 || !strings.HasPrefix(report.Skipped[0], "link 5:") {
+		t.Fatalf("unexpected skipped links: %q", report.Skipped)
+	}
+	data, err := os.ReadFile(filepath.Join(subDir, "DE.json"))
+	if err != nil || !strings.Contains(string(data), `"de.example.com"`) {
+		t.Fatalf("DE.json = %s, err=%v", data, err)
+	}
+
+	report, err = manager.Refresh(context.Background(), source)
+	if err != nil {
+		t.Fatalf("second refresh failed: %v", err)
+	}
+	if report.Changed() || report.Unchanged != 3 {
+		t.Fatalf("expected nothing to change, got %+v", report)
+	}
+
+	// A sidecar of a server that leaves goes with it; files the subscription
+	// did not write stay, even when they were renamed from one of its files.
+	writeTestFile(t, filepath.Join(subDir, "DE-2.meta"), `{"label":"Germany 2"}`)
+	if err := os.Rename(filepath.Join(subDir, "DE.json"), filepath.Join(subDir, "Berlin.json")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(subDir, "own.json"), `{}`)
+
+	f.set(http.StatusOK, strings.Replace(nl, "nl.example.com:443", "nl.example.com:8443", 1), deOther)
+	report, err = manager.Refresh(context.Background(), source)
+	if err != nil {
+		t.Fatalf("third refresh failed: %v", err)
+	}
+	if !slices.Equal(report.Added, []string{"DE.json"}) || !slices.Equal(report.Updated, []string{"NL.json"}) || !slices.Equal(report.Removed, []string{"DE-2.json"}) {
+		t.Fatalf("unexpected third report: %+v", report)
+	}
+	for _, name := range []string{"DE-2.json", "DE-2.meta"} {
+		if _, err := os.Stat(filepath.Join(subDir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected %s to be removed, got: %v", name, err)
+		}
+	}
+	for _, name := range []string{"Berlin.json", "own.json"} {
+		if _, err := os.Stat(filepath.Join(subDir, name)); err != nil {
+			t.Fatalf("expected %s to be kept, got: %v", name, err)
+		}
+	}
+
+	// A server named like a file the user put there is skipped, and the file
+	// stays when the server leaves again.
+	f.set(http.StatusOK, deOther, "trojan://secret@own.example.com:443#own")
+	report, err = manager.Refresh(context.Background(), source)
+	if err != nil {
+		t.Fatalf("fourth refresh failed: %v", err)
+	}
+	if len(report.Skipped) != 1 || !strings.HasPrefix(report.Skipped[0], "own.json:") || slices.Contains(report.Updated, "own.json") {
+		t.Fatalf("expected own.json to be skipped, got %+v", report)
+	}
+	f.set(http.StatusOK, deOther)
+	if _, err := manager.Refresh(context.Background(), source); err != nil {
+		t.Fatalf("fifth refresh failed: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(subDir, "own.json")); err != nil || string(data) != `{}` {
+		t.Fatalf("expected own.json to be untouched, got %q, err=%v", data, err)
+	}
+}
+
+func TestRefreshKeepsFilesWithoutManifest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("trojan://secret@de.example.com:443#DE"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	subDir := filepath.Join(dir, "provider")
+	if err := os.MkdirAll(subDir, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(subDir, "old.json"), `{}`)
+	writeTestFile(t, filepath.Join(subDir, "DE.json"), `{}`)
+
+	report, err := New(dir, nil).Refresh(context.Background(), Source{Name: "provider", URL: server.URL})
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if report.Changed() || len(report.Skipped) != 1 || !strings.HasPrefix(report.Skipped[0], "DE.json:") {
+		t.Fatalf("expected DE.json to be skipped and nothing to change, got %+v", report)
+	}
+	for _, name := range []string{"old.json", "DE.json"} {
+		if data, err := os.ReadFile(filepath.Join(subDir, name)); err != nil || string(data) != `{}` {
+			t.Fatalf("expected %s to be untouched, got %q, err=%v", name, data, err)
+		}
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshKeepsConfigsOnFailure(t *testing.T) {
+	f := &feed{}
+	server := httptest.NewServer(f)
+	defer server.Close()
+
+	dir := t.TempDir()
+	manager := New(dir, nil)
+	source := Source{Name: "provider", URL: server.URL + "/sub?token=secret-token"}
+
+	f.set(http.StatusOK, "trojan://secret@de.example.com:443#DE")
+	if _, err := manager.Refresh(context.Background(), source); err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+
+	f.set(http.StatusOK)
+	if _, err := manager.Refresh(context.Background(), source); !errors.Is(err, ErrNoServers) {
+		t.Fatalf("expected ErrNoServers, got: %v", err)
+	}
+
+	f.set(http.StatusInternalServerError, "trojan://secret@de.example.com:443#DE")
+	_, err := manager.Refresh(context.Background(), source)
+	if err == nil || strings.Contains(err.Error(), "secret-token") {
+		t.Fatalf("expected an error without the url, got: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "provider", "DE.json")); err != nil {
+		t.Fatalf("expected DE.json to be kept, got: %v", err)
+	}
+}
+
+func TestRefreshAcceptsPlainLinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("trojan://secret@de.example.com:443#DE\r\n"))
+	}))
+	defer server.Close()
+
+	report, err := New(t.TempDir(), nil).Refresh(context.Background(), Source{Name: "plain", URL: server.URL})
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if !slices.Equal(report.Added, []string{"DE.json"}) {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+}
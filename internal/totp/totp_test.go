@@ -0,0 +1,67 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test secret "12345678901234567890" in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeMatchesRFC6238(t *testing.T) {
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, want := range cases {
+		got, err := Code(rfcSecret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("Code returned error: %v", err)
+		}
+		if got != want {
+			t.Fatalf("Code at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidateAcceptsAdjacentStep(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	previous, err := Code(rfcSecret, now.Add(-Period))
+	if err != nil {
+		t.Fatalf("Code returned error: %v", err)
+	}
+
+	if _, ok := Validate(rfcSecret, previous, now); !ok {
+		t.Fatal("expected code from previous period to be accepted")
+	}
+
+	stale, err := Code(rfcSecret, now.Add(-3*Period))
+	if err != nil {
+		t.Fatalf("Code returned error: %v", err)
+	}
+	if _, ok := Validate(rfcSecret, stale, now); ok {
+		t.Fatal("expected stale code to be rejected")
+	}
+	if _, ok := Validate(rfcSecret, "12345", now); ok {
+		t.Fatal("expected short code to be rejected")
+	}
+}
+
+func TestGenerateSecretAndURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret returned error: %v", err)
+	}
+	if _, err := DecodeSecret(secret); err != nil {
+		t.Fatalf("generated secret does not decode: %v", err)
+	}
+
+	uri := URI(secret, "xray-tlg", "alice")
+	if !strings.HasPrefix(uri, "otpauth://totp/xray-tlg:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("unexpected uri: %s", uri)
+	}
+}
@@ -0,0 +1,104 @@
+package xrayconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// IsSnippet reports whether data is a profile meant to be merged into a base
+// template: a JSON object with outbounds but without inbounds.
+func IsSnippet(data []byte) bool {
+	var root map[string]json.RawMessage
+	if err := json.Unmarshal(data, &root); err != nil {
+		return false
+	}
+	_, hasInbounds := root["inbounds"]
+	_, hasOutbounds := root["outbounds"]
+	return hasOutbounds && !hasInbounds
+}
+
+// Compose merges a snippet into the base template. Top-level keys of the
+// snippet replace those of the template, except outbounds: the snippet's
+// outbounds come first, so the first one stays the default, followed by the
+// template outbounds whose tag the snippet does not define.
+func Compose(template, snippet []byte) ([]byte, error) {
+	base, err := decodeObject(template)
+	if err != nil {
+		return nil, fmt.Errorf("decode template: %w", err)
+	}
+	overlay, err := decodeObject(snippet)
+	if err != nil {
+		return nil, fmt.Errorf("decode snippet: %w", err)
+	}
+
+	baseOutbounds, err := outboundList(base)
+	if err != nil {
+		return nil, fmt.Errorf("template: %w", err)
+	}
+	outbounds, err := outboundList(overlay)
+	if err != nil {
+		return nil, fmt.Errorf("snippet: %w", err)
+	}
+
+	tags := make(map[string]struct{}, len(outbounds))
+	for _, outbound := range outbounds {
+		if tag := proxyTag(outbound); tag != "" {
+			tags[tag] = struct{}{}
+		}
+	}
+	for _, outbound := range baseOutbounds {
+		if _, ok := tags[proxyTag(outbound)]; ok {
+			continue
+		}
+		outbounds = append(outbounds, outbound)
+	}
+
+	for key, value := range overlay {
+		base[key] = value
+	}
+	base["outbounds"] = outbounds
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(base); err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func decodeObject(data []byte) (map[string]any, error) {
+	value, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("top level must be a JSON object")
+	}
+	return object, nil
+}
+
+func outboundList(config map[string]any) ([]any, error) {
+	value, ok := config["outbounds"]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	outbounds, ok := value.([]any)
+	if !ok {
+		return nil, errors.New(`"outbounds" must be an array`)
+	}
+	return outbounds, nil
+}
+
+func proxyTag(value any) string {
+	object, ok := value.(map[string]any)
+	if !ok {
+		return ""
+	}
+	tag, _ := object["tag"].(string)
+	return tag
+}
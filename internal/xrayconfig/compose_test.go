@@ -0,0 +1,68 @@
+package xrayconfig
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestComposeMergesSnippetIntoTemplate(t *testing.T) {
+	template, err := os.ReadFile(filepath.Join("..", "..", "testdata", "templates", "base.json"))
+	if err != nil {
+		t.Fatalf("read template failed: %v", err)
+	}
+	snippet := []byte(`{
+  "remarks": "EU <fast>",
+  "outbounds": [
+    {"protocol": "vless", "tag": "proxy"},
+    {"protocol": "freedom", "tag": "direct", "settings": {"domainStrategy": "UseIPv4"}}
+  ]
+}`)
+	if !IsSnippet(snippet) || IsSnippet(template) {
+		t.Fatalf("IsSnippet misclassified the snippet or the template")
+	}
+
+	data, err := Compose(template, snippet)
+	if err != nil {
+		t.Fatalf("Compose returned error: %v", err)
+	}
+	if err := Validate(data); err != nil {
+		t.Fatalf("composed config is invalid: %v", err)
+	}
+
+	var config struct {
+		Remarks   string            `json:"remarks"`
+		Inbounds  []json.RawMessage `json:"inbounds"`
+		Outbounds []struct {
+			Tag      string         `json:"tag"`
+			Settings map[string]any `json:"settings"`
+		} `json:"outbounds"`
+		Routing map[string]any `json:"routing"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("decode composed config failed: %v", err)
+	}
+	if config.Remarks != "EU <fast>" || len(config.Inbounds) != 1 || config.Routing == nil {
+		t.Fatalf("template keys were not kept: %s", data)
+	}
+	var tags []string
+	for _, outbound := range config.Outbounds {
+		tags = append(tags, outbound.Tag)
+	}
+	if len(tags) != 3 || tags[0] != "proxy" || tags[1] != "direct" || tags[2] != "block" {
+		t.Fatalf("unexpected outbound order: %v", tags)
+	}
+	if config.Outbounds[1].Settings["domainStrategy"] != "UseIPv4" {
+		t.Fatalf("snippet outbound did not replace the template one: %s", data)
+	}
+}
+
+func TestComposeRejectsInvalidInput(t *testing.T) {
+	if _, err := Compose([]byte(`{"outbounds": {}}`), []byte(`{"outbounds": []}`)); err == nil {
+		t.Fatalf("expected error for template outbounds that are not an array")
+	}
+	if _, err := Compose([]byte(`{}`), []byte(`[]`)); err == nil {
+		t.Fatalf("expected error for a snippet that is not an object")
+	}
+}
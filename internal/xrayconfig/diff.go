@@ -0,0 +1,177 @@
+package xrayconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// Change is one difference between two configs. Old and New hold decoded
+// JSON values with secrets already masked.
+type Change struct {
+	Path string
+	Kind string
+	Old  any
+	New  any
+}
+
+// Diff compares two JSON documents semantically: key order and formatting
+// are ignored, and arrays whose elements all carry a unique "tag" (inbounds,
+// outbounds) are matched by tag instead of by position. An empty document
+// counts as an empty object, so every key of the other one is added.
+func Diff(oldData, newData []byte) ([]Change, error) {
+	oldValue, err := decodeJSON(oldData)
+	if err != nil {
+		return nil, fmt.Errorf("decode old config: %w", err)
+	}
+	newValue, err := decodeJSON(newData)
+	if err != nil {
+		return nil, fmt.Errorf("decode new config: %w", err)
+	}
+
+	var changes []Change
+	diffValues("", false, oldValue, newValue, &changes)
+	return changes, nil
+}
+
+func decodeJSON(data []byte) (any, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return map[string]any{}, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func diffValues(path string, secret bool, oldValue, newValue any, changes *[]Change) {
+	switch oldTyped := oldValue.(type) {
+	case map[string]any:
+		if newTyped, ok := newValue.(map[string]any); ok {
+			diffObjects(path, oldTyped, newTyped, changes)
+			return
+		}
+	case []any:
+		if newTyped, ok := newValue.([]any); ok {
+			diffArrays(path, secret, oldTyped, newTyped, changes)
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, Change{
+			Path: path,
+			Kind: ChangeChanged,
+			Old:  redactValue(secret, oldValue),
+			New:  redactValue(secret, newValue),
+		})
+	}
+}
+
+func diffObjects(path string, oldObject, newObject map[string]any, changes *[]Change) {
+	keys := make([]string, 0, len(oldObject)+len(newObject))
+	for key := range oldObject {
+		keys = append(keys, key)
+	}
+	for key := range newObject {
+		if _, ok := oldObject[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := key
+		if path != "" {
+			childPath = path + "." + key
+		}
+		secret := IsSecretKey(key)
+		oldChild, inOld := oldObject[key]
+		newChild, inNew := newObject[key]
+		switch {
+		case !inNew:
+			*changes = append(*changes, Change{Path: childPath, Kind: ChangeRemoved, Old: redactValue(secret, oldChild)})
+		case !inOld:
+			*changes = append(*changes, Change{Path: childPath, Kind: ChangeAdded, New: redactValue(secret, newChild)})
+		default:
+			diffValues(childPath, secret, oldChild, newChild, changes)
+		}
+	}
+}
+
+func diffArrays(path string, secret bool, oldArray, newArray []any, changes *[]Change) {
+	oldTags, oldTagged := tagIndex(oldArray)
+	newTags, newTagged := tagIndex(newArray)
+	if oldTagged && newTagged {
+		for _, item := range oldArray {
+			tag := item.(map[string]any)["tag"].(string)
+			childPath := fmt.Sprintf("%s[%s]", path, tag)
+			if newIndex, ok := newTags[tag]; ok {
+				diffValues(childPath, secret, item, newArray[newIndex], changes)
+				continue
+			}
+			*changes = append(*changes, Change{Path: childPath, Kind: ChangeRemoved, Old: redactValue(secret, item)})
+		}
+		for _, item := range newArray {
+			tag := item.(map[string]any)["tag"].(string)
+			if _, ok := oldTags[tag]; !ok {
+				*changes = append(*changes, Change{Path: fmt.Sprintf("%s[%s]", path, tag), Kind: ChangeAdded, New: redactValue(secret, item)})
+			}
+		}
+		return
+	}
+
+	for i := 0; i < max(len(oldArray), len(newArray)); i++ {
+		childPath := fmt.Sprintf("%s[%d]", path, i)
+		switch {
+		case i >= len(newArray):
+			*changes = append(*changes, Change{Path: childPath, Kind: ChangeRemoved, Old: redactValue(secret, oldArray[i])})
+		case i >= len(oldArray):
+			*changes = append(*changes, Change{Path: childPath, Kind: ChangeAdded, New: redactValue(secret, newArray[i])})
+		default:
+			diffValues(childPath, secret, oldArray[i], newArray[i], changes)
+		}
+	}
+}
+
+// tagIndex maps tags to positions when every element is an object with a
+// unique, non-empty "tag".
+func tagIndex(items []any) (map[string]int, bool) {
+	if len(items) == 0 {
+		return nil, true
+	}
+	index := make(map[string]int, len(items))
+	for i, item := range items {
+		object, ok := item.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		tag, ok := object["tag"].(string)
+		if !ok || tag == "" {
+			return nil, false
+		}
+		if _, duplicate := index[tag]; duplicate {
+			return nil, false
+		}
+		index[tag] = i
+	}
+	return index, true
+}
+
+func redactValue(secret bool, value any) any {
+	if secret {
+		return maskSecret(value)
+	}
+	return Redact(value)
+}
@@ -0,0 +1,99 @@
+package xrayconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffMatchesTaggedProxiesByTag(t *testing.T) {
+	oldConfig := `{
+  "log": {"loglevel": "warning"},
+  "outbounds": [
+    {"tag": "proxy", "protocol": "vless", "settings": {"vnext": [{"address": "a.example.com", "users": [{"id": "old-uuid"}]}]}},
+    {"tag": "direct", "protocol": "freedom"}
+  ]
+}`
+	newConfig := `{
+  "outbounds": [
+    {"tag": "direct", "protocol": "freedom"},
+    {"tag": "proxy", "protocol": "vless", "settings": {"vnext": [{"address": "b.example.com", "users": [{"id": "new-uuid"}]}]}},
+    {"tag": "block", "protocol": "blackhole"}
+  ],
+  "log": {"loglevel": "debug"}
+}`
+
+	changes, err := Diff([]byte(oldConfig), []byte(newConfig))
+	if err != nil {
+		t.Fatalf("Diff returned error: %v", err)
+	}
+
+	got := make(map[string]Change, len(changes))
+	for _, change := range changes {
+		got[change.Path] = change
+	}
+	if len(got) != 4 {
+		t.Fatalf("Diff returned %d changes, want 4: %+v", len(changes), changes)
+	}
+	if change := got["log.loglevel"]; change.Kind != ChangeChanged || change.New != "debug" {
+		t.Fatalf("log.loglevel change = %+v", change)
+	}
+	if change := got["outbounds[proxy].settings.vnext[0].address"]; change.Kind != ChangeChanged || change.New != "b.example.com" {
+		t.Fatalf("address change = %+v", change)
+	}
+	if change := got["outbounds[proxy].settings.vnext[0].users[0].id"]; change.Old != RedactedValue || change.New != RedactedValue {
+		t.Fatalf("id change leaks the secret: %+v", change)
+	}
+	if change := got["outbounds[block]"]; change.Kind != ChangeAdded {
+		t.Fatalf("outbounds[block] change = %+v", change)
+	}
+}
+
+func TestDiffRedactsAddedSubtrees(t *testing.T) {
+	changes, err := Diff([]byte(`{}`), []byte(`{"outbounds": [{"protocol": "trojan", "settings": {"servers": [{"password": "hunter2"}]}}]}`))
+	if err != nil {
+		t.Fatalf("Diff returned error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Kind != ChangeAdded || changes[0].Path != "outbounds" {
+		t.Fatalf("Diff = %+v", changes)
+	}
+	if text := strings.Join(stringValues(changes[0].New), ","); strings.Contains(text, "hunter2") {
+		t.Fatalf("added value leaks the password: %s", text)
+	}
+}
+
+func TestDiffEmptyOldConfig(t *testing.T) {
+	changes, err := Diff(nil, []byte(`{"log": {}}`))
+	if err != nil {
+		t.Fatalf("Diff returned error: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Kind != ChangeAdded || changes[0].Path != "log" {
+		t.Fatalf("Diff = %+v", changes)
+	}
+}
+
+func TestDiffRejectsInvalidJSON(t *testing.T) {
+	if _, err := Diff([]byte(`{}`), []byte(`{`)); err == nil {
+		t.Fatal("Diff accepted invalid JSON")
+	}
+}
+
+func stringValues(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case map[string]any:
+		var values []string
+		for _, child := range v {
+			values = append(values, stringValues(child)...)
+		}
+		return values
+	case []any:
+		var values []string
+		for _, child := range v {
+			values = append(values, stringValues(child)...)
+		}
+		return values
+	default:
+		return nil
+	}
+}
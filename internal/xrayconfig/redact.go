@@ -0,0 +1,103 @@
+package xrayconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RedactedValue replaces secrets in diffs and exported configs.
+const RedactedValue = "<redacted>"
+
+// secretKeys are the lower-cased JSON keys whose values identify or
+// authenticate a user: UUIDs, passwords, private and pre-shared keys and
+// Reality short IDs.
+var secretKeys = map[string]struct{}{
+	"id":           {},
+	"password":     {},
+	"pass":         {},
+	"auth":         {},
+	"privatekey":   {},
+	"secretkey":    {},
+	"presharedkey": {},
+	"psk":          {},
+	"seed":         {},
+	"key":          {},
+	"shortid":      {},
+	"shortids":     {},
+	"token":        {},
+}
+
+func IsSecretKey(key string) bool {
+	_, ok := secretKeys[strings.ToLower(key)]
+	return ok
+}
+
+// Redact returns a copy of a decoded JSON value with every secret masked.
+func Redact(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		redacted := make(map[string]any, len(v))
+		for key, child := range v {
+			if IsSecretKey(key) {
+				redacted[key] = maskSecret(child)
+				continue
+			}
+			redacted[key] = Redact(child)
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(v))
+		for i, child := range v {
+			redacted[i] = Redact(child)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// maskSecret keeps the shape of the value, so an empty secret or a list of
+// short IDs is still recognisable.
+func maskSecret(value any) any {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return v
+		}
+		return RedactedValue
+	case []any:
+		masked := make([]any, len(v))
+		for i, child := range v {
+			masked[i] = maskSecret(child)
+		}
+		return masked
+	case map[string]any:
+		return Redact(v)
+	case nil:
+		return nil
+	default:
+		return RedactedValue
+	}
+}
+
+// RedactJSON returns an indented copy of a JSON document with every secret
+// masked. Numbers are kept as written.
+func RedactJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("decode config: %w", err)
+	}
+
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(Redact(value)); err != nil {
+		return nil, fmt.Errorf("encode config: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,48 @@
+package xrayconfig
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactMasksSecrets(t *testing.T) {
+	value := map[string]any{
+		"realitySettings": map[string]any{
+			"publicKey":  "pub",
+			"privateKey": "priv",
+			"shortIds":   []any{"ab", ""},
+		},
+		"users": []any{map[string]any{"id": "uuid", "flow": "xtls-rprx-vision"}},
+	}
+
+	redacted := Redact(value).(map[string]any)
+	reality := redacted["realitySettings"].(map[string]any)
+	if reality["publicKey"] != "pub" || reality["privateKey"] != RedactedValue {
+		t.Fatalf("realitySettings = %v", reality)
+	}
+	if shortIDs := reality["shortIds"].([]any); shortIDs[0] != RedactedValue || shortIDs[1] != "" {
+		t.Fatalf("shortIds = %v", shortIDs)
+	}
+	user := redacted["users"].([]any)[0].(map[string]any)
+	if user["id"] != RedactedValue || user["flow"] != "xtls-rprx-vision" {
+		t.Fatalf("user = %v", user)
+	}
+	if value["realitySettings"].(map[string]any)["privateKey"] != "priv" {
+		t.Fatal("Redact modified its input")
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	data, err := RedactJSON([]byte(`{"outbounds": [{"port": 443, "settings": {"vnext": [{"users": [{"id": "b831381d-6324-4d53-ad4f-8cda48b30811"}]}]}}]}`))
+	if err != nil {
+		t.Fatalf("RedactJSON returned error: %v", err)
+	}
+	text := string(data)
+	if strings.Contains(text, "b831381d") || !strings.Contains(text, `"id": "<redacted>"`) || !strings.Contains(text, `"port": 443`) {
+		t.Fatalf("unexpected redacted config:\n%s", text)
+	}
+
+	if _, err := RedactJSON([]byte(`{`)); err == nil {
+		t.Fatal("RedactJSON accepted invalid JSON")
+	}
+}
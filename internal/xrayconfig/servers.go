@@ -0,0 +1,77 @@
+package xrayconfig
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+)
+
+type serverOutbound struct {
+	Settings struct {
+		Vnext   []serverAddress `json:"vnext"`
+		Servers []serverAddress `json:"servers"`
+		Peers   []struct {
+			Endpoint string `json:"endpoint"`
+		} `json:"peers"`
+	} `json:"settings"`
+	StreamSettings struct {
+		TLSSettings     serverName `json:"tlsSettings"`
+		RealitySettings serverName `json:"realitySettings"`
+	} `json:"streamSettings"`
+}
+
+type serverAddress struct {
+	Address string `json:"address"`
+}
+
+type serverName struct {
+	ServerName string `json:"serverName"`
+}
+
+// ServerAddresses returns the remote hosts the outbounds of a config connect
+// to, and the TLS or Reality server names they present, without duplicates.
+// Outbounds that cannot be decoded are skipped.
+func ServerAddresses(data []byte) []string {
+	var config struct {
+		Outbounds []json.RawMessage `json:"outbounds"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil
+	}
+
+	seen := make(map[string]struct{})
+	var addresses []string
+	add := func(address string) {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			return
+		}
+		if _, ok := seen[address]; !ok {
+			seen[address] = struct{}{}
+			addresses = append(addresses, address)
+		}
+	}
+
+	for _, raw := range config.Outbounds {
+		var outbound serverOutbound
+		if err := json.Unmarshal(raw, &outbound); err != nil {
+			continue
+		}
+		for _, server := range outbound.Settings.Vnext {
+			add(server.Address)
+		}
+		for _, server := range outbound.Settings.Servers {
+			add(server.Address)
+		}
+		for _, peer := range outbound.Settings.Peers {
+			if host, _, err := net.SplitHostPort(peer.Endpoint); err == nil {
+				add(host)
+			} else {
+				add(peer.Endpoint)
+			}
+		}
+		add(outbound.StreamSettings.TLSSettings.ServerName)
+		add(outbound.StreamSettings.RealitySettings.ServerName)
+	}
+	return addresses
+}
@@ -0,0 +1,30 @@
+package xrayconfig
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestServerAddresses(t *testing.T) {
+	data := []byte(`{
+  "outbounds": [
+    {
+      "protocol": "vless",
+      "settings": {"vnext": [{"address": "de.example.com", "port": 443}]},
+      "streamSettings": {"realitySettings": {"serverName": "www.apple.com"}}
+    },
+    {"protocol": "trojan", "settings": {"servers": [{"address": "203.0.113.7"}, {"address": "de.example.com"}]}},
+    {"protocol": "wireguard", "settings": {"peers": [{"endpoint": "[2001:db8::1]:51820"}]}},
+    {"protocol": "freedom", "settings": {"servers": "broken"}},
+    {"protocol": "blackhole"}
+  ]
+}`)
+	want := []string{"de.example.com", "www.apple.com", "203.0.113.7", "2001:db8::1"}
+	if got := ServerAddresses(data); !slices.Equal(got, want) {
+		t.Fatalf("ServerAddresses = %q, want %q", got, want)
+	}
+
+	if got := ServerAddresses([]byte(`not json`)); got != nil {
+		t.Fatalf("expected no addresses for invalid JSON, got %q", got)
+	}
+}
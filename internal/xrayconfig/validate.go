@@ -0,0 +1,271 @@
+package xrayconfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var inboundProtocols = map[string]struct{}{
+	"dokodemo-door": {},
+	"tunnel":        {},
+	"http":          {},
+	"mixed":         {},
+	"shadowsocks":   {},
+	"socks":         {},
+	"trojan":        {},
+	"tun":           {},
+	"vless":         {},
+	"vmess":         {},
+	"wireguard":     {},
+}
+
+var outboundProtocols = map[string]struct{}{
+	"blackhole":   {},
+	"dns":         {},
+	"freedom":     {},
+	"http":        {},
+	"hysteria":    {},
+	"loopback":    {},
+	"shadowsocks": {},
+	"socks":       {},
+	"trojan":      {},
+	"vless":       {},
+	"vmess":       {},
+	"wireguard":   {},
+}
+
+// ValidationError lists every problem found in a config, so the user can fix
+// them all at once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid xray config: " + strings.Join(e.Problems, "; ")
+}
+
+type proxy struct {
+	Protocol string          `json:"protocol"`
+	Tag      string          `json:"tag"`
+	Listen   string          `json:"listen"`
+	Port     json.RawMessage `json:"port"`
+}
+
+type portRange struct {
+	from, to int
+}
+
+// Validate checks that data is an Xray JSON config with inbounds and
+// outbounds, unique tags, known protocols and no two inbounds on the same
+// port. It returns a *ValidationError describing the problems.
+func Validate(data []byte) error {
+	var root map[string]json.RawMessage
+	if err := json.Unmarshal(data, &root); err != nil {
+		return &ValidationError{Problems: []string{describeSyntaxError(data, err)}}
+	}
+
+	var problems []string
+	inbounds, inboundProblems := decodeSection(root, "inbounds")
+	problems = append(problems, inboundProblems...)
+	outbounds, outboundProblems := decodeSection(root, "outbounds")
+	problems = append(problems, outboundProblems...)
+	if outboundProblems == nil && len(outbounds) == 0 {
+		problems = append(problems, `"outbounds" must contain at least one outbound`)
+	}
+
+	problems = append(problems, checkProxies("inbound", inbounds, inboundProtocols)...)
+	problems = append(problems, checkProxies("outbound", outbounds, outboundProtocols)...)
+	problems = append(problems, checkInboundPorts(inbounds)...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func decodeSection(root map[string]json.RawMessage, name string) ([]proxy, []string) {
+	raw, ok := root[name]
+	if !ok || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil, []string{fmt.Sprintf("missing %q section", name)}
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, []string{fmt.Sprintf("%q must be an array", name)}
+	}
+
+	proxies := make([]proxy, 0, len(items))
+	var problems []string
+	for i, item := range items {
+		var p proxy
+		if err := json.Unmarshal(item, &p); err != nil {
+			problems = append(problems, fmt.Sprintf("%s[%d] is not a valid object", name, i))
+			continue
+		}
+		proxies = append(proxies, p)
+	}
+	return proxies, problems
+}
+
+func checkProxies(kind string, proxies []proxy, known map[string]struct{}) []string {
+	var problems []string
+	tags := make(map[string]int, len(proxies))
+	for i, p := range proxies {
+		name := describeProxy(kind, i, p)
+		switch {
+		case p.Protocol == "":
+			problems = append(problems, fmt.Sprintf("%s has no protocol", name))
+		default:
+			if _, ok := known[strings.ToLower(p.Protocol)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s uses unknown protocol %q", name, p.Protocol))
+			}
+		}
+
+		if p.Tag == "" {
+			continue
+		}
+		if first, ok := tags[p.Tag]; ok {
+			problems = append(problems, fmt.Sprintf("%s #%d and #%d share tag %q", kind, first+1, i+1, p.Tag))
+			continue
+		}
+		tags[p.Tag] = i
+	}
+	return problems
+}
+
+func checkInboundPorts(inbounds []proxy) []string {
+	type bound struct {
+		index  int
+		listen string
+		ports  portRange
+	}
+
+	var problems []string
+	var seen []bound
+	for i, in := range inbounds {
+		ports, ok, err := parsePort(in.Port)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s has invalid port: %v", describeProxy("inbound", i, in), err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		current := bound{index: i, listen: normalizeListen(in.Listen), ports: ports}
+		for _, other := range seen {
+			if !listenOverlaps(current.listen, other.listen) || !current.ports.overlaps(other.ports) {
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("inbound #%d and #%d both listen on port %s",
+				other.index+1, i+1, current.ports))
+		}
+		seen = append(seen, current)
+	}
+	return problems
+}
+
+// parsePort accepts a number, a numeric string or a "from-to" range. Ports
+// taken from environment variables ("env:...") cannot be checked and are
+// skipped.
+func parsePort(raw json.RawMessage) (portRange, bool, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return portRange{}, false, nil
+	}
+
+	var number int
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return makePortRange(number, number)
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return portRange{}, false, errors.New("must be a number or a string")
+	}
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "env:") || strings.Contains(text, ",") {
+		return portRange{}, false, nil
+	}
+
+	from, to, isRange := strings.Cut(text, "-")
+	if !isRange {
+		to = from
+	}
+	fromPort, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return portRange{}, false, fmt.Errorf("%q is not a port", text)
+	}
+	toPort, err := strconv.Atoi(strings.TrimSpace(to))
+	if err != nil {
+		return portRange{}, false, fmt.Errorf("%q is not a port", text)
+	}
+	return makePortRange(fromPort, toPort)
+}
+
+func makePortRange(from, to int) (portRange, bool, error) {
+	if from < 1 || to > 65535 || from > to {
+		return portRange{}, false, fmt.Errorf("%d-%d is out of range", from, to)
+	}
+	return portRange{from: from, to: to}, true, nil
+}
+
+func (r portRange) overlaps(other portRange) bool {
+	return r.from <= other.to && other.from <= r.to
+}
+
+func (r portRange) String() string {
+	if r.from == r.to {
+		return strconv.Itoa(r.from)
+	}
+	return fmt.Sprintf("%d-%d", r.from, r.to)
+}
+
+func normalizeListen(listen string) string {
+	switch listen {
+	case "", "0.0.0.0", "::", "[::]":
+		return ""
+	default:
+		return listen
+	}
+}
+
+// listenOverlaps treats an empty address as "all interfaces", which clashes
+// with every other address on the same port.
+func listenOverlaps(a, b string) bool {
+	return a == "" || b == "" || a == b
+}
+
+func describeProxy(kind string, index int, p proxy) string {
+	if p.Tag != "" {
+		return fmt.Sprintf("%s #%d (%s)", kind, index+1, p.Tag)
+	}
+	return fmt.Sprintf("%s #%d", kind, index+1)
+}
+
+func describeSyntaxError(data []byte, err error) string {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line, column := lineAndColumn(data, syntaxErr.Offset)
+		return fmt.Sprintf("invalid JSON at line %d, column %d: %v", line, column, syntaxErr)
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return "config must be a JSON object"
+	}
+	return fmt.Sprintf("invalid JSON: %v", err)
+}
+
+func lineAndColumn(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
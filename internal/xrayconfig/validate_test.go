@@ -0,0 +1,92 @@
+package xrayconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateAcceptsTestdata(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "testdata", "xray-configs", "*.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no testdata configs found: %v", err)
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s failed: %v", path, err)
+		}
+		if err := Validate(data); err != nil {
+			t.Fatalf("Validate(%s) returned error: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestValidateReportsProblems(t *testing.T) {
+	cases := map[string]struct {
+		config string
+		want   string
+	}{
+		"truncated": {
+			config: "{\n  \"inbounds\": [",
+			want:   "invalid JSON at line 2",
+		},
+		"not an object": {
+			config: `[]`,
+			want:   "must be a JSON object",
+		},
+		"missing outbounds": {
+			config: `{"inbounds": []}`,
+			want:   `missing "outbounds" section`,
+		},
+		"empty outbounds": {
+			config: `{"inbounds": [], "outbounds": []}`,
+			want:   "at least one outbound",
+		},
+		"duplicate tags": {
+			config: `{"inbounds": [], "outbounds": [{"protocol": "freedom", "tag": "out"}, {"protocol": "blackhole", "tag": "out"}]}`,
+			want:   `outbound #1 and #2 share tag "out"`,
+		},
+		"unknown protocol": {
+			config: `{"inbounds": [{"protocol": "sockz", "port": 1080}], "outbounds": [{"protocol": "freedom"}]}`,
+			want:   `unknown protocol "sockz"`,
+		},
+		"port conflict": {
+			config: `{"inbounds": [{"protocol": "socks", "port": 1080}, {"protocol": "http", "port": "1000-2000", "listen": "127.0.0.1"}], "outbounds": [{"protocol": "freedom"}]}`,
+			want:   "inbound #1 and #2 both listen on port 1000-2000",
+		},
+		"invalid port": {
+			config: `{"inbounds": [{"protocol": "socks", "port": 70000}], "outbounds": [{"protocol": "freedom"}]}`,
+			want:   "invalid port",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := Validate([]byte(tc.config))
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("expected ValidationError, got %v", err)
+			}
+			if !strings.Contains(strings.Join(invalid.Problems, "\n"), tc.want) {
+				t.Fatalf("problems %q do not mention %q", invalid.Problems, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateAllowsPortsOnDifferentAddresses(t *testing.T) {
+	config := `{
+  "inbounds": [
+    {"protocol": "socks", "port": 1080, "listen": "127.0.0.1", "tag": "a"},
+    {"protocol": "socks", "port": "1080", "listen": "127.0.0.2", "tag": "b"}
+  ],
+  "outbounds": [{"protocol": "freedom"}]
+}`
+	if err := Validate([]byte(config)); err != nil {
+		t.Fatalf("Validate returned error: %v", err)
+	}
+}